@@ -0,0 +1,260 @@
+package configcheck
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/matcher"
+)
+
+// events are all the events a message template can have a message for
+var events = []internal.Event{
+	internal.MatchEvent,
+	internal.ResolvedEvent,
+	internal.SuccessEvent,
+	internal.FailureEvent,
+	internal.SkippedEvent,
+	internal.RetryEvent,
+	internal.ApprovalEvent,
+}
+
+// Problem is an issue found in the configuration, File and Line are empty when
+// it couldn't be located in the sources.
+//
+// Warnings are problems the configuration works despite of, like shadowed
+// matchers or commands missing where the configuration is checked, the rest
+// are errors that make it unusable
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+	Warning bool
+}
+
+func (p Problem) String() string {
+	message := p.Message
+	if p.Warning {
+		message = "warning: " + message
+	}
+	if p.File == "" {
+		return message
+	}
+	return fmt.Sprintf("%s: %s", location{p.File, p.Line}, message)
+}
+
+// Errors returns the problems that are not warnings
+func Errors(problems []Problem) []Problem {
+	errs := make([]Problem, 0, len(problems))
+	for _, p := range problems {
+		if !p.Warning {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// Check looks for the problems that the configuration would only show when an
+// alert is matched: broken templates, commands that can't be executed,
+// matchers defined more than once and matchers that can never match because an
+// earlier one always does.
+//
+// The sources are the yaml of the files the configuration was read from, by
+// file name, used to locate the problems
+func Check(cnf internal.Configuration, sources map[string][]byte) []Problem {
+	l := newLocator(cnf, sources)
+	problems := make([]Problem, 0)
+
+	for _, err := range matcher.Validate(cnf) {
+		e, ok := err.(*matcher.MatcherError)
+		if !ok {
+			problems = append(problems, Problem{Message: err.Error()})
+			continue
+		}
+		if name := cnf.Matchers[e.Index].Name; name != "" {
+			problems = append(problems, l.matcher(e.Index, e.Key).problem("matcher %s: %s", name, e.Err))
+		} else {
+			problems = append(problems, l.matcher(e.Index, e.Key).problem("%s", e.Err))
+		}
+	}
+
+	if cnf.DefaultTemplate != nil {
+		for _, e := range checkTemplate(*cnf.DefaultTemplate) {
+			problems = append(problems, l.defaultTemplate(templateKey(e.event)).problem(
+				"default template: %s", e.err))
+		}
+	}
+
+	first := make(map[string]int)
+	for i, m := range cnf.Matchers {
+		if j, ok := first[m.Name]; ok {
+			problems = append(problems, l.matcher(i, "name").problem(
+				"matcher %s is defined more than once, first%s", m.Name, l.matcher(j, "").in()))
+		} else {
+			first[m.Name] = i
+		}
+
+		if m.Template != nil {
+			for _, e := range checkTemplate(*m.Template) {
+				problems = append(problems, l.matcher(i, templateKey(e.event)).problem(
+					"matcher %s: %s", m.Name, e.err))
+			}
+		}
+
+		if m.DryRun {
+			continue
+		}
+		if err := checkCommand(m.Command); err != nil {
+			problems = append(problems, l.matcher(i, "command").warning(
+				"matcher %s: %s", m.Name, err))
+		}
+		if m.ResolvedCommand != "" {
+			if err := checkCommand(m.ResolvedCommand); err != nil {
+				problems = append(problems, l.matcher(i, "resolved_command").warning(
+					"matcher %s: resolved %s", m.Name, err))
+			}
+		}
+	}
+
+	// With a routing tree every matcher is executed by name, so they can't
+	// shadow each other
+	if cnf.Route == nil {
+		for i, m := range cnf.Matchers {
+			for j := 0; j < i; j++ {
+				earlier := cnf.Matchers[j]
+				if earlier.Name == m.Name || !shadows(earlier, m) {
+					continue
+				}
+				problems = append(problems, l.matcher(i, "").warning(
+					"matcher %s is shadowed by matcher %s%s, which matches all the alerts it does",
+					m.Name, earlier.Name, l.matcher(j, "").in()))
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+type templateError struct {
+	event internal.Event
+	err   error
+}
+
+func checkTemplate(t internal.MessageTemplate) []templateError {
+	errs := make([]templateError, 0)
+	for _, event := range events {
+		if _, err := template.New(string(event)).Parse(t.GetMessage(event)); err != nil {
+			errs = append(errs, templateError{
+				event: event,
+				err:   fmt.Errorf("invalid %s template: %s", event, err),
+			})
+		}
+	}
+	return errs
+}
+
+func templateKey(event internal.Event) string {
+	if event == internal.MatchEvent {
+		return "on_match"
+	}
+	return "on_" + string(event)
+}
+
+func checkCommand(command string) error {
+	if command == "" {
+		return fmt.Errorf("command is empty")
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return fmt.Errorf("command %s can't be executed: %s", command, err)
+	}
+	return nil
+}
+
+// shadows returns true when the earlier matcher matches every alert group the
+// later one does, which then never executes.
+//
+// It only compares the configurations, so it can miss regexes that are
+// different but match the same values
+func shadows(earlier, later internal.MatcherConfiguration) bool {
+	if mode(earlier) != mode(later) {
+		return false
+	}
+
+	for status := range statuses(later) {
+		if !statuses(earlier)[status] {
+			return false
+		}
+	}
+
+	if !subset(earlier.Labels, later.Labels) ||
+		!subset(earlier.Annotations, later.Annotations) ||
+		!subset(earlier.GroupLabels, later.GroupLabels) {
+		return false
+	}
+
+	for _, m := range earlier.Matchers {
+		if !contains(later.Matchers, m) {
+			return false
+		}
+	}
+
+	if earlier.Receiver != "" && earlier.Receiver != later.Receiver {
+		return false
+	}
+	if earlier.ExternalURL != "" && earlier.ExternalURL != later.ExternalURL {
+		return false
+	}
+	return earlier.MinFiringAlerts <= later.MinFiringAlerts
+}
+
+func mode(m internal.MatcherConfiguration) string {
+	if m.Mode == "" {
+		return internal.GroupMode
+	}
+	return m.Mode
+}
+
+// statuses returns the statuses the matcher reacts to
+func statuses(m internal.MatcherConfiguration) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, status := range m.Statuses {
+		accepted[status] = true
+	}
+	if len(accepted) == 0 {
+		accepted[internal.FiringStatus] = true
+		accepted[internal.ResolvedStatus] = true
+	}
+	if m.ResolvedCommand != "" {
+		accepted[internal.ResolvedStatus] = true
+	}
+	return accepted
+}
+
+// subset returns true when every regex of a is also set in b for the same name
+func subset(a, b map[string]string) bool {
+	for name, regex := range a {
+		if other, ok := b[name]; !ok || other != regex {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) == strings.TrimSpace(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package configcheck_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/configcheck"
+)
+
+func TestShadowedMatchers(t *testing.T) {
+	tests := []struct {
+		name     string
+		earlier  internal.MatcherConfiguration
+		later    internal.MatcherConfiguration
+		shadowed bool
+	}{
+		{
+			"catch all",
+			internal.MatcherConfiguration{},
+			internal.MatcherConfiguration{Labels: map[string]string{"alertname": "^Stuck$"}},
+			true,
+		},
+		{
+			"same labels",
+			internal.MatcherConfiguration{Labels: map[string]string{"alertname": "^Stuck$"}},
+			internal.MatcherConfiguration{Labels: map[string]string{"alertname": "^Stuck$", "env": "prod"}},
+			true,
+		},
+		{
+			"different labels",
+			internal.MatcherConfiguration{Labels: map[string]string{"alertname": "^Stuck$"}},
+			internal.MatcherConfiguration{Labels: map[string]string{"alertname": "^Down$"}},
+			false,
+		},
+		{
+			"label matchers",
+			internal.MatcherConfiguration{Matchers: []string{`env="prod"`}},
+			internal.MatcherConfiguration{Matchers: []string{`alertname="Stuck"`, ` env="prod"`}},
+			true,
+		},
+		{
+			"fewer statuses",
+			internal.MatcherConfiguration{Statuses: []string{internal.FiringStatus}},
+			internal.MatcherConfiguration{},
+			false,
+		},
+		{
+			"resolved command",
+			internal.MatcherConfiguration{Statuses: []string{internal.FiringStatus}, ResolvedCommand: "echo"},
+			internal.MatcherConfiguration{},
+			true,
+		},
+		{
+			"different mode",
+			internal.MatcherConfiguration{},
+			internal.MatcherConfiguration{Mode: internal.PerAlertMode},
+			false,
+		},
+		{
+			"more firing alerts",
+			internal.MatcherConfiguration{MinFiringAlerts: 3},
+			internal.MatcherConfiguration{MinFiringAlerts: 2},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.earlier.Name, tt.earlier.Command = "earlier", "echo"
+			tt.later.Name, tt.later.Command = "later", "echo"
+
+			problems := configcheck.Check(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{tt.earlier, tt.later},
+			}, nil)
+			if tt.shadowed {
+				assert.Equal(t, []configcheck.Problem{{
+					Message: "matcher later is shadowed by matcher earlier, which matches all the alerts it does",
+					Warning: true,
+				}}, problems)
+			} else {
+				assert.Empty(t, problems)
+			}
+		})
+	}
+}
+
+func TestWarningsAreNotErrors(t *testing.T) {
+	problems := configcheck.Check(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{Name: "earlier", Command: "echo"},
+			{Name: "later", Command: "not-a-real-command"},
+			{Name: "earlier", Command: "echo"},
+		},
+	}, nil)
+	assert.Equal(t, []configcheck.Problem{{
+		Message: "matcher earlier is defined more than once, first",
+	}}, configcheck.Errors(problems))
+}
+
+func TestRoutesDoNotShadowMatchers(t *testing.T) {
+	problems := configcheck.Check(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{Name: "earlier", Command: "echo"},
+			{Name: "later", Command: "echo"},
+		},
+		Route: &internal.RouteConfiguration{Execute: []string{"earlier", "later"}},
+	}, nil)
+	assert.Empty(t, problems)
+}
+
+func TestInvalidMatchersAreReported(t *testing.T) {
+	problems := configcheck.Check(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{Name: "dry", Command: "not-a-real-command", DryRun: true, Statuses: []string{"firing"}},
+			{Name: "broken", Command: "echo", Labels: map[string]string{"alertname": "("}},
+			{Name: "negative", Command: "echo", Mode: internal.PerAlertMode, CooldownSeconds: -1},
+		},
+	}, nil)
+	assert.Equal(t, []configcheck.Problem{
+		{Message: "matcher broken: Failed to compile regex for label alertname ((): error parsing regexp: missing closing ): `(`"},
+		{Message: "matcher negative: Cooldown can't be negative in matcher negative"},
+	}, problems)
+}
+
+func TestInvalidMatchersAreLocated(t *testing.T) {
+	source := []byte(`---
+matchers:
+  - name: broken
+    command: echo
+    labels:
+      alertname: (
+  - name: negative
+    command: echo
+    statuses: [firing]
+    cooldown_seconds: -1
+`)
+	problems := configcheck.Check(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{Name: "broken", Command: "echo", Labels: map[string]string{"alertname": "("}, File: "config.yaml"},
+			{Name: "negative", Command: "echo", Statuses: []string{"firing"}, CooldownSeconds: -1, File: "config.yaml"},
+		},
+	}, map[string][]byte{"config.yaml": source})
+
+	messages := make([]string, 0)
+	for _, p := range problems {
+		messages = append(messages, p.String())
+	}
+	assert.Equal(t, []string{
+		"config.yaml:5: matcher broken: Failed to compile regex for label alertname ((): error parsing regexp: missing closing ): `(`",
+		"config.yaml:10: matcher negative: Cooldown can't be negative in matcher negative",
+	}, messages)
+}
@@ -0,0 +1,191 @@
+package configcheck
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+// location is a line of a configuration file, line is zero when only the
+// file is known and file is empty when nothing is
+type location struct {
+	file string
+	line int
+}
+
+func (l location) String() string {
+	if l.line == 0 {
+		return l.file
+	}
+	return fmt.Sprintf("%s:%d", l.file, l.line)
+}
+
+// in describes where the location is, if it is known
+func (l location) in() string {
+	if l.file == "" {
+		return ""
+	}
+	return " in " + l.String()
+}
+
+func (l location) problem(format string, args ...interface{}) Problem {
+	return Problem{
+		File:    l.file,
+		Line:    l.line,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (l location) warning(format string, args ...interface{}) Problem {
+	p := l.problem(format, args...)
+	p.Warning = true
+	return p
+}
+
+// locator finds the locations of the configuration keys in the files it was
+// read from
+type locator struct {
+	files map[string]fileLocator
+
+	// defaultTemplateFile is the only file that can define it
+	defaultTemplateFile string
+
+	// matchers are the file of each matcher and its index in the file
+	matchers []matcherLocation
+}
+
+type matcherLocation struct {
+	file  string
+	index int
+}
+
+func newLocator(cnf internal.Configuration, sources map[string][]byte) locator {
+	l := locator{files: make(map[string]fileLocator)}
+	for name, source := range sources {
+		f := newFileLocator(source)
+		l.files[name] = f
+		if f.defaults.end != 0 {
+			l.defaultTemplateFile = name
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, m := range cnf.Matchers {
+		l.matchers = append(l.matchers, matcherLocation{m.File, counts[m.File]})
+		counts[m.File]++
+	}
+	return l
+}
+
+func (l locator) defaultTemplate(key string) location {
+	f, ok := l.files[l.defaultTemplateFile]
+	if !ok {
+		return location{}
+	}
+	return location{l.defaultTemplateFile, f.find(f.defaults, key)}
+}
+
+func (l locator) matcher(i int, key string) location {
+	m := l.matchers[i]
+	f, ok := l.files[m.file]
+	if !ok {
+		return location{}
+	}
+	line := 0
+	if m.index < len(f.matchers) {
+		line = f.find(f.matchers[m.index], key)
+	}
+	return location{m.file, line}
+}
+
+// span is a range of lines, with the end excluded and both starting at zero
+type span struct {
+	start, end int
+}
+
+// fileLocator finds the lines of the configuration keys in the yaml source.
+//
+// The yaml parser doesn't keep the lines, so it only understands the block
+// style the configuration is usually written in, and returns zero for what it
+// can't find
+type fileLocator struct {
+	lines    []string
+	defaults span
+	matchers []span
+}
+
+var (
+	topLevelKey = regexp.MustCompile(`^([a-z_]+):`)
+	listItem    = regexp.MustCompile(`^(\s*)- `)
+)
+
+func newFileLocator(source []byte) fileLocator {
+	l := fileLocator{lines: strings.Split(string(source), "\n")}
+
+	for key, s := range l.topLevelKeys() {
+		switch key {
+		case "default_template":
+			l.defaults = s
+		case "matchers":
+			l.matchers = l.items(s)
+		}
+	}
+	return l
+}
+
+// topLevelKeys returns the lines each key of the document spans
+func (l fileLocator) topLevelKeys() map[string]span {
+	keys := make(map[string]span)
+	key := ""
+	for i, line := range l.lines {
+		m := topLevelKey.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if key != "" {
+			keys[key] = span{keys[key].start, i}
+		}
+		key = m[1]
+		keys[key] = span{i, len(l.lines)}
+	}
+	return keys
+}
+
+// items returns the lines each item of the list in the span covers
+func (l fileLocator) items(s span) []span {
+	items := make([]span, 0)
+	indent := ""
+	for i := s.start + 1; i < s.end; i++ {
+		m := listItem.FindStringSubmatch(l.lines[i])
+		if m == nil || (len(items) > 0 && m[1] != indent) {
+			continue
+		}
+		if len(items) > 0 {
+			items[len(items)-1].end = i
+		}
+		indent = m[1]
+		items = append(items, span{i, s.end})
+	}
+	return items
+}
+
+// find returns the line of the first key in the span, or where the span starts
+// when the key is empty
+func (l fileLocator) find(s span, key string) int {
+	if s.end == 0 {
+		return 0
+	}
+	if key == "" {
+		return s.start + 1
+	}
+
+	re := regexp.MustCompile(`^[\s-]*` + regexp.QuoteMeta(key) + `:`)
+	for i := s.start; i < s.end; i++ {
+		if re.MatchString(l.lines[i]) {
+			return i + 1
+		}
+	}
+	return s.start + 1
+}
@@ -0,0 +1,143 @@
+package configtest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/matcher"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/server"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/templater"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/webhook"
+)
+
+// Case is a webhook payload to replay, with the matchers that are expected to
+// execute their command for it
+type Case struct {
+	Filename string
+
+	// Expected is nil when there are no expectations, and empty when no
+	// matcher is expected to execute
+	Expected []string
+}
+
+// ParseCase parses an argument like payload.json, or payload.json=a,b to
+// expect the matchers a and b to execute, or payload.json= to expect none
+func ParseCase(arg string) Case {
+	parts := strings.SplitN(arg, "=", 2)
+
+	c := Case{Filename: parts[0]}
+	if len(parts) == 2 {
+		c.Expected = make([]string, 0)
+		for _, name := range strings.Split(parts[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				c.Expected = append(c.Expected, name)
+			}
+		}
+	}
+	return c
+}
+
+// Run replays the payloads against the configuration without executing any
+// command, writing which matchers would execute, why the others wouldn't, and
+// the messages that would be announced.
+//
+// Returns false when the configuration or any payload are invalid, or when
+// any expectation is not met
+func Run(w io.Writer, cnf internal.Configuration, cases []Case, now time.Time) bool {
+	m, err := matcher.New(cnf)
+	if err != nil {
+		fmt.Fprintf(w, "invalid configuration: %s\n", secrets.Redact(err.Error()))
+		return false
+	}
+	t := templater.Templater{DefaultTemplate: cnf.DefaultTemplate}
+
+	ok := true
+	for _, c := range cases {
+		if !run(w, m, t, c, now) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func run(w io.Writer, m matcher.Matcher, t templater.Templater, c Case, now time.Time) bool {
+	fmt.Fprintf(w, "%s:\n", c.Filename)
+
+	b, err := ioutil.ReadFile(c.Filename)
+	if err != nil {
+		fmt.Fprintf(w, "  FAIL: failed to read payload: %s\n", err)
+		return false
+	}
+	ag, err := webhook.Parse(b)
+	if err != nil {
+		fmt.Fprintf(w, "  FAIL: %s\n", err)
+		return false
+	}
+
+	for _, e := range m.Explain(*ag) {
+		if e.Selected {
+			fmt.Fprintf(w, "  %s: matches\n", e.Matcher)
+		} else {
+			fmt.Fprintf(w, "  %s: does not match, %s\n", e.Matcher, e.Reason)
+		}
+	}
+
+	ok := true
+	executed := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range m.Match(*ag) {
+		if !seen[match.Name()] {
+			seen[match.Name()] = true
+			executed = append(executed, match.Name())
+		}
+
+		fmt.Fprintf(w, "  %s would be executed", match.Name())
+		if match.Alert() != nil {
+			fmt.Fprintf(w, " for alert %v", match.Alert().Labels)
+		}
+		switch {
+		case match.Muted(now):
+			fmt.Fprintf(w, ", but not now as it is outside of its time intervals")
+		case match.Deferred(now):
+			fmt.Fprintf(w, ", but not until the alerts have been firing long enough")
+		}
+		fmt.Fprintln(w)
+
+		event := match.Event()
+		if match.Approval() > 0 {
+			event = internal.ApprovalEvent
+		}
+		message, err := t.WithTemplate(match.Template()).Expand(event, server.TemplatePayload{
+			AlertGroup: *ag,
+			Alert:      match.Alert(),
+			Match:      match,
+		})
+		if err != nil {
+			fmt.Fprintf(w, "    FAIL: %s\n", secrets.Redact(err.Error()))
+			ok = false
+			continue
+		}
+		fmt.Fprintf(w, "    %s message: %s\n", event, secrets.Redact(message))
+	}
+
+	if c.Expected != nil {
+		expected := append([]string{}, c.Expected...)
+		sort.Strings(expected)
+		sort.Strings(executed)
+		if strings.Join(expected, ",") != strings.Join(executed, ",") {
+			fmt.Fprintf(w, "  FAIL: expected %v to be executed, got %v\n", expected, executed)
+			ok = false
+		}
+	}
+
+	if ok {
+		fmt.Fprintf(w, "  OK\n")
+	}
+	return ok
+}
@@ -0,0 +1,90 @@
+package configtest_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/configtest"
+)
+
+func TestParseCase(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(configtest.Case{Filename: "payload.json"}, configtest.ParseCase("payload.json"))
+	a.Equal(configtest.Case{Filename: "payload.json", Expected: []string{}},
+		configtest.ParseCase("payload.json="))
+	a.Equal(configtest.Case{Filename: "payload.json", Expected: []string{"a", "b"}},
+		configtest.ParseCase("payload.json=a, b"))
+}
+
+var cnf = internal.Configuration{
+	DefaultTemplate: &internal.MessageTemplate{
+		OnMatch: "restarting {{ .AlertGroup.CommonLabels.namespace }}",
+	},
+	Matchers: []internal.MatcherConfiguration{
+		{
+			Name:    "restart-backend",
+			Command: "restart.sh",
+			Labels:  map[string]string{"namespace": "^backend$"},
+		},
+		{
+			Name:     "restart-frontend",
+			Command:  "restart.sh",
+			Matchers: []string{`alertname="PodIsStuck"`},
+		},
+		{
+			Name:    "fallback",
+			Command: "echo",
+		},
+	},
+}
+
+func TestRun(t *testing.T) {
+	a := assert.New(t)
+	w := bytes.NewBufferString("")
+
+	a.True(configtest.Run(w, cnf, []configtest.Case{
+		configtest.ParseCase("fixtures/pod-is-stuck.json=restart-frontend"),
+	}, time.Now()))
+	a.Equal(`fixtures/pod-is-stuck.json:
+  restart-backend: does not match, label namespace="frontend" does not match ^backend$
+  restart-frontend: matches
+  fallback: does not match, a previous matcher matched first
+  restart-frontend would be executed
+    match message: restarting frontend
+  OK
+`, w.String())
+}
+
+func TestRunFails(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        configtest.Case
+		expected string
+	}{
+		{
+			"unexpected matcher",
+			configtest.ParseCase("fixtures/pod-is-stuck.json=restart-backend"),
+			"  FAIL: expected [restart-backend] to be executed, got [restart-frontend]\n",
+		},
+		{
+			"missing payload",
+			configtest.ParseCase("fixtures/missing.json"),
+			"fixtures/missing.json:\n  FAIL: failed to read payload: " +
+				"open fixtures/missing.json: no such file or directory\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			w := bytes.NewBufferString("")
+
+			a.False(configtest.Run(w, cnf, []configtest.Case{tt.c}, time.Now()))
+			a.Contains(w.String(), tt.expected)
+		})
+	}
+}
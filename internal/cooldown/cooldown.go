@@ -0,0 +1,48 @@
+package cooldown
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker keeps track of the cooldown windows that are open for a key
+type Tracker struct {
+	m     *sync.Mutex
+	until map[string]time.Time
+}
+
+// New returns a new cooldown tracker without any window open
+func New() *Tracker {
+	return &Tracker{
+		m:     &sync.Mutex{},
+		until: make(map[string]time.Time),
+	}
+}
+
+// Allow returns true and opens a window of the given duration when there is no
+// window open for the key at the given time, false otherwise
+func (t *Tracker) Allow(key string, window time.Duration, now time.Time) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for k, until := range t.until {
+		if !now.Before(until) {
+			delete(t.until, k)
+		}
+	}
+
+	if _, ok := t.until[key]; ok {
+		return false
+	}
+
+	t.until[key] = now.Add(window)
+	return true
+}
+
+// Forget closes the window for the key, if any
+func (t *Tracker) Forget(key string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	delete(t.until, key)
+}
@@ -0,0 +1,25 @@
+package cooldown_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/cooldown"
+)
+
+func TestCooldownWindows(t *testing.T) {
+	a := assert.New(t)
+	c := cooldown.New()
+	now := time.Now()
+
+	a.True(c.Allow("key", time.Minute, now), "first time is allowed")
+	a.False(c.Allow("key", time.Minute, now.Add(30*time.Second)), "inside the window is not allowed")
+	a.True(c.Allow("other-key", time.Minute, now.Add(30*time.Second)), "other keys are allowed")
+	a.True(c.Allow("key", time.Minute, now.Add(time.Minute)), "after the window is allowed")
+	a.False(c.Allow("key", time.Minute, now.Add(90*time.Second)), "a new window is opened")
+
+	c.Forget("key")
+	a.True(c.Allow("key", time.Minute, now.Add(90*time.Second)), "forgotten windows are allowed")
+}
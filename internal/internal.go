@@ -37,20 +37,127 @@ type Alert struct {
 
 // Configuration represents the configuration of the alert matchers
 type Configuration struct {
-	Matchers        []MatcherConfiguration `yaml:"matchers,omitempty"`
-	DefaultTemplate *MessageTemplate       `yaml:"default_template,omitempty"`
+	Matchers        []MatcherConfiguration      `yaml:"matchers,omitempty"`
+	DefaultTemplate *MessageTemplate            `yaml:"default_template,omitempty"`
+	Route           *RouteConfiguration         `yaml:"route,omitempty"`
+	TimeIntervals   []TimeIntervalConfiguration `yaml:"time_intervals,omitempty"`
+
+	// Include are globs of more configuration files, relative to the file
+	// that includes them, whose matchers are added after the ones of the file
+	Include []string `yaml:"include,omitempty"`
 }
 
+// TimeIntervalConfiguration is a named list of time intervals, which contains
+// a time when any of the intervals does
+type TimeIntervalConfiguration struct {
+	Name          string                      `yaml:"name"`
+	TimeIntervals []TimeIntervalSpecification `yaml:"time_intervals"`
+}
+
+// TimeIntervalSpecification is a time interval that contains a time when all
+// the configured constraints do, empty constraints contain any time
+type TimeIntervalSpecification struct {
+	Weekdays []string                 `yaml:"weekdays,omitempty"`
+	Times    []TimeRangeConfiguration `yaml:"times,omitempty"`
+	Location string                   `yaml:"location,omitempty"`
+}
+
+// TimeRangeConfiguration is a range of the day, with the end excluded
+type TimeRangeConfiguration struct {
+	StartTime string `yaml:"start_time"`
+	EndTime   string `yaml:"end_time"`
+}
+
+// RouteConfiguration is a node of the routing tree, it executes the named
+// matchers when the alert group matches it and none of its child routes do
+type RouteConfiguration struct {
+	Matchers []string             `yaml:"matchers,omitempty"`
+	Execute  []string             `yaml:"execute,omitempty"`
+	Continue bool                 `yaml:"continue,omitempty"`
+	Routes   []RouteConfiguration `yaml:"routes,omitempty"`
+}
+
+// Alert and alert group statuses as sent by the alertmanager
+const (
+	FiringStatus   = "firing"
+	ResolvedStatus = "resolved"
+)
+
+// Matching modes, either the common labels and annotations of the whole group
+// are matched, or each alert in the group is matched on its own
+const (
+	GroupMode    = "group"
+	PerAlertMode = "per_alert"
+)
+
 // MatcherConfiguration provides configuration to match alerts and map them to a
 // command with arguments
 type MatcherConfiguration struct {
-	Name        string            `yaml:"name"`
-	Labels      map[string]string `yaml:"labels"`
-	Annotations map[string]string `yaml:"annotations"`
-	Command     string            `yaml:"command"`
-	Arguments   []string          `yaml:"args"`
-	Template    *MessageTemplate  `yaml:"template,omitempty"`
-	Timeout     int               `yaml:"timeout_seconds"`
+	Name        string                   `yaml:"name"`
+	Labels      map[string]string        `yaml:"labels"`
+	Annotations map[string]string        `yaml:"annotations"`
+	Matchers    []string                 `yaml:"matchers,omitempty"`
+	Statuses    []string                 `yaml:"statuses,omitempty"`
+	Mode        string                   `yaml:"mode,omitempty"`
+	Command     string                   `yaml:"command"`
+	Arguments   []string                 `yaml:"args"`
+	Parameters  []ParameterConfiguration `yaml:"params,omitempty"`
+	Template    *MessageTemplate         `yaml:"template,omitempty"`
+	Timeout     int                      `yaml:"timeout_seconds"`
+
+	Receiver        string            `yaml:"receiver,omitempty"`
+	GroupLabels     map[string]string `yaml:"group_labels,omitempty"`
+	ExternalURL     string            `yaml:"external_url,omitempty"`
+	MinFiringAlerts int               `yaml:"min_firing_alerts,omitempty"`
+
+	MinFiringSeconds int `yaml:"min_firing_seconds,omitempty"`
+
+	ActiveTimeIntervals []string `yaml:"active_time_intervals,omitempty"`
+	MuteTimeIntervals   []string `yaml:"mute_time_intervals,omitempty"`
+
+	RequireApproval        bool `yaml:"require_approval,omitempty"`
+	ApprovalTimeoutSeconds int  `yaml:"approval_timeout_seconds,omitempty"`
+
+	DryRun bool `yaml:"dry_run,omitempty"`
+
+	Env          map[string]string          `yaml:"env,omitempty"`
+	AlertContext *AlertContextConfiguration `yaml:"alert_context,omitempty"`
+
+	Retry *RetryConfiguration `yaml:"retry,omitempty"`
+
+	CooldownSeconds int      `yaml:"cooldown_seconds,omitempty"`
+	CooldownLabels  []string `yaml:"cooldown_labels,omitempty"`
+
+	ResolvedCommand   string   `yaml:"resolved_command,omitempty"`
+	ResolvedArguments []string `yaml:"resolved_args,omitempty"`
+
+	// File is the configuration file the matcher was loaded from
+	File string `yaml:"-"`
+}
+
+// ParameterConfiguration defines a value extracted from a label that can be
+// used in the arguments once validated
+type ParameterConfiguration struct {
+	Name  string `yaml:"name"`
+	Label string `yaml:"label"`
+	Regex string `yaml:"regex"`
+}
+
+// AlertContextConfiguration defines how the alert is passed to the command
+// without using the arguments
+type AlertContextConfiguration struct {
+	Env            bool `yaml:"env"`
+	Stdin          bool `yaml:"stdin"`
+	File           bool `yaml:"file"`
+	MaxValueLength int  `yaml:"max_value_length,omitempty"`
+}
+
+// RetryConfiguration defines how failed commands are executed again
+type RetryConfiguration struct {
+	MaxAttempts           int   `yaml:"max_attempts"`
+	InitialBackoffSeconds int   `yaml:"initial_backoff_seconds,omitempty"`
+	MaxBackoffSeconds     int   `yaml:"max_backoff_seconds,omitempty"`
+	RetryableExitCodes    []int `yaml:"retryable_exit_codes,omitempty"`
 }
 
 // Messenger represents an object capable of sending a message to somewhere
@@ -58,11 +165,22 @@ type Messenger interface {
 	Send(Event, string) error
 }
 
+// ApprovalMessenger is a Messenger that can also send messages with actions to
+// approve or reject the job with the given id
+type ApprovalMessenger interface {
+	Messenger
+	SendApproval(message, jobID string) error
+}
+
 // MessageTemplate is the message to send when the match is successful
 type MessageTemplate struct {
-	OnMatch   string `yaml:"on_match"`
-	OnSuccess string `yaml:"on_success"`
-	OnFailure string `yaml:"on_failure"`
+	OnMatch    string `yaml:"on_match"`
+	OnResolved string `yaml:"on_resolved,omitempty"`
+	OnSuccess  string `yaml:"on_success"`
+	OnFailure  string `yaml:"on_failure"`
+	OnSkipped  string `yaml:"on_skipped,omitempty"`
+	OnRetry    string `yaml:"on_retry,omitempty"`
+	OnApproval string `yaml:"on_approval,omitempty"`
 }
 
 // GetMessage returns the template according to the event type
@@ -71,12 +189,24 @@ func (m MessageTemplate) GetMessage(event Event) string {
 	case MatchEvent:
 		return m.OnMatch
 
+	case ResolvedEvent:
+		return m.OnResolved
+
 	case SuccessEvent:
 		return m.OnSuccess
 
 	case FailureEvent:
 		return m.OnFailure
 
+	case SkippedEvent:
+		return m.OnSkipped
+
+	case RetryEvent:
+		return m.OnRetry
+
+	case ApprovalEvent:
+		return m.OnApproval
+
 	}
 	logrus.Panicf("Invalid event %s", event)
 	return ""
@@ -84,9 +214,13 @@ func (m MessageTemplate) GetMessage(event Event) string {
 
 // Constants used to signal the different kind of events
 const (
-	MatchEvent   = Event("match")
-	SuccessEvent = Event("success")
-	FailureEvent = Event("failure")
+	MatchEvent    = Event("match")
+	ResolvedEvent = Event("resolved")
+	SuccessEvent  = Event("success")
+	FailureEvent  = Event("failure")
+	SkippedEvent  = Event("skipped")
+	RetryEvent    = Event("retry")
+	ApprovalEvent = Event("approval")
 )
 
 // Event is an extension of a string used to map the different colors of the events
@@ -95,10 +229,12 @@ type Event string
 // Color returns the color given the kind of event it is
 func (e Event) Color() string {
 	switch e {
-	case SuccessEvent:
+	case SuccessEvent, ResolvedEvent:
 		return "good" // Green
 	case FailureEvent:
 		return "danger" // Red
+	case SkippedEvent:
+		return "#a0a0a0" // Grey
 	}
 	return "warning" // Matchevent will be yellow
 }
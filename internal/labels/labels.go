@@ -0,0 +1,129 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MatchType is the kind of comparison a matcher does
+type MatchType string
+
+// The match types, using the same operators as the alertmanager
+const (
+	MatchEqual     = MatchType("=")
+	MatchNotEqual  = MatchType("!=")
+	MatchRegexp    = MatchType("=~")
+	MatchNotRegexp = MatchType("!~")
+)
+
+var matcherRegexp = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(=~|=|!=|!~)\s*(.*?)\s*$`)
+
+// Matcher compares the value of a label, which is empty when the label is
+// missing, the same way the alertmanager does
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// Matches returns true when the label value matches
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	panic(fmt.Sprintf("invalid match type %s", m.Type))
+}
+
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// ParseMatcher parses a single matcher like `severity!="info"`, in which the
+// value may be unquoted
+func ParseMatcher(s string) (*Matcher, error) {
+	parts := matcherRegexp.FindStringSubmatch(s)
+	if parts == nil {
+		return nil, fmt.Errorf("invalid matcher %q, it must be like name=\"value\" with one of =, !=, =~ or !~", s)
+	}
+
+	value := parts[3]
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted value in matcher %q: %s", s, err)
+		}
+		value = unquoted
+	} else if strings.Contains(value, `"`) {
+		return nil, fmt.Errorf("invalid unquoted value in matcher %q: it can't contain quotes", s)
+	}
+
+	m := &Matcher{
+		Type:  MatchType(parts[2]),
+		Name:  parts[1],
+		Value: value,
+	}
+
+	if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in matcher %q: %s", s, err)
+		}
+		m.re = re
+	}
+
+	return m, nil
+}
+
+// ParseMatchers parses a comma separated list of matchers, optionally
+// surrounded by curly braces, like `{severity!="info", namespace=~"a|b"}`
+func ParseMatchers(s string) ([]*Matcher, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+
+	matchers := make([]*Matcher, 0)
+	for _, part := range split(s) {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		m, err := ParseMatcher(part)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// split splits the string by the commas that are not quoted
+func split(s string) []string {
+	parts := make([]string, 0)
+	quoted, escaped := false, false
+	start := 0
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,74 @@
+package labels_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/labels"
+)
+
+func TestParsingMatchers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		err      string
+	}{
+		{`severity="critical"`, []string{`severity="critical"`}, ""},
+		{`severity = critical`, []string{`severity="critical"`}, ""},
+		{`severity!="info"`, []string{`severity!="info"`}, ""},
+		{`namespace=~"a|b"`, []string{`namespace=~"a|b"`}, ""},
+		{`namespace!~"kube-.*"`, []string{`namespace!~"kube-.*"`}, ""},
+		{`{a="1", b!="2"}`, []string{`a="1"`, `b!="2"`}, ""},
+		{`a="with, comma", b="with \"quotes\""`, []string{`a="with, comma"`, `b="with \"quotes\""`}, ""},
+		{`{}`, []string{}, ""},
+		{`a`, nil, `invalid matcher "a", it must be like name="value" with one of =, !=, =~ or !~`},
+		{`0a="b"`, nil, `invalid matcher "0a=\"b\"", it must be like name="value" with one of =, !=, =~ or !~`},
+		{`a="b`, nil, `invalid quoted value in matcher "a=\"b": invalid syntax`},
+		{`a=="b"`, nil, `invalid unquoted value in matcher "a==\"b\"": it can't contain quotes`},
+		{`a=~"["`, nil, "invalid regex in matcher \"a=~\\\"[\\\"\": error parsing regexp: missing closing ]: `[)$`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			a := assert.New(t)
+			matchers, err := labels.ParseMatchers(tt.input)
+			if tt.err != "" {
+				a.EqualError(err, tt.err)
+				return
+			}
+
+			a.NoError(err)
+			parsed := make([]string, 0)
+			for _, m := range matchers {
+				parsed = append(parsed, m.String())
+			}
+			a.Equal(tt.expected, parsed)
+		})
+	}
+}
+
+func TestMatching(t *testing.T) {
+	tests := []struct {
+		matcher string
+		value   string
+		matches bool
+	}{
+		{`a="b"`, "b", true},
+		{`a="b"`, "bb", false},
+		{`a=""`, "", true},
+		{`a!="b"`, "c", true},
+		{`a!="b"`, "b", false},
+		{`a!=""`, "", false},
+		{`a=~"b|c"`, "c", true},
+		{`a=~"b"`, "bb", false},
+		{`a!~"b|c"`, "d", true},
+		{`a!~"b|c"`, "b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.matcher+" "+tt.value, func(t *testing.T) {
+			m, err := labels.ParseMatcher(tt.matcher)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.matches, m.Matches(tt.value))
+		})
+	}
+}
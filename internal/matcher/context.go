@@ -0,0 +1,172 @@
+package matcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+const (
+	// defaultMaxValueLength is the maximum length in bytes of a label or
+	// annotation value passed as an environment variable
+	defaultMaxValueLength = 256
+
+	// maxContextLength is the maximum length in bytes of the alert context
+	// passed through stdin or a file
+	maxContextLength = 1 << 20
+
+	envPrefix = "CAE_"
+)
+
+var (
+	invalidEnvChars = regexp.MustCompile("[^A-Z0-9_]")
+	validEnvName    = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+)
+
+// alertContext is the document passed to commands through stdin or a file
+type alertContext struct {
+	Matcher    string              `json:"matcher"`
+	AlertGroup internal.AlertGroup `json:"alertGroup"`
+	Alert      *internal.Alert     `json:"alert,omitempty"`
+}
+
+type alertContextPolicy struct {
+	env            bool
+	stdin          bool
+	file           bool
+	maxValueLength int
+}
+
+func newAlertContextPolicy(name string, ac *internal.AlertContextConfiguration) (alertContextPolicy, error) {
+	if ac == nil {
+		return alertContextPolicy{}, nil
+	}
+
+	if ac.MaxValueLength < 0 {
+		return alertContextPolicy{}, fmt.Errorf("Alert context max value length can't be negative in matcher %s", name)
+	}
+
+	p := alertContextPolicy{
+		env:            ac.Env,
+		stdin:          ac.Stdin,
+		file:           ac.File,
+		maxValueLength: ac.MaxValueLength,
+	}
+	if p.maxValueLength == 0 {
+		p.maxValueLength = defaultMaxValueLength
+	}
+	return p, nil
+}
+
+// prepare sets up the command environment and stdin with the alert context,
+// returning a function that cleans up whatever was created
+func (c cmdExecutor) prepare(cmd *exec.Cmd) (func(), error) {
+	cleanup := func() {}
+
+	env := make([]string, 0)
+	for name, value := range c.env {
+		env = append(env, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	if c.context.env {
+		env = append(env, c.contextEnv()...)
+	}
+
+	if c.context.stdin || c.context.file {
+		b, err := json.Marshal(alertContext{
+			Matcher:    c.matcherName,
+			AlertGroup: c.alertGroup,
+			Alert:      c.alert,
+		})
+		if err != nil {
+			return cleanup, fmt.Errorf("failed to encode alert context: %s", err)
+		}
+		if len(b) > maxContextLength {
+			return cleanup, fmt.Errorf("alert context is %d bytes long, which is over the limit of %d",
+				len(b), maxContextLength)
+		}
+
+		if c.context.stdin {
+			cmd.Stdin = strings.NewReader(string(b))
+		}
+
+		if c.context.file {
+			f, err := ioutil.TempFile("", "chief-alert-executor-")
+			if err != nil {
+				return cleanup, fmt.Errorf("failed to create alert context file: %s", err)
+			}
+			cleanup = func() { os.Remove(f.Name()) }
+
+			_, err = f.Write(b)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return cleanup, fmt.Errorf("failed to write alert context file: %s", err)
+			}
+			env = append(env, fmt.Sprintf("%sALERT_FILE=%s", envPrefix, f.Name()))
+		}
+	}
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	return cleanup, nil
+}
+
+// contextEnv returns the alert labels and annotations as sanitized environment
+// variables, using the common ones when matching the whole group
+func (c cmdExecutor) contextEnv() []string {
+	status := c.alertGroup.Status
+	labels := c.alertGroup.CommonLabels
+	annotations := c.alertGroup.CommonAnnotations
+	if c.alert != nil {
+		status = c.alert.Status
+		labels = c.alert.Labels
+		annotations = c.alert.Annotations
+	}
+
+	env := []string{
+		envVar("MATCHER", c.matcherName, c.context.maxValueLength),
+		envVar("STATUS", status, c.context.maxValueLength),
+	}
+	for name, value := range labels {
+		env = append(env, envVar("LABEL_"+name, value, c.context.maxValueLength))
+	}
+	for name, value := range annotations {
+		env = append(env, envVar("ANNOTATION_"+name, value, c.context.maxValueLength))
+	}
+	return env
+}
+
+// envVar builds an environment variable replacing any character that is not
+// valid in the name with an underscore, and removing control characters from
+// the value, which is truncated to the max length
+func envVar(name, value string, maxLength int) string {
+	name = invalidEnvChars.ReplaceAllString(strings.ToUpper(name), "_")
+
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+
+	if len(value) > maxLength {
+		value = value[:maxLength]
+		for !utf8.ValidString(value) {
+			value = value[:len(value)-1]
+		}
+	}
+
+	return fmt.Sprintf("%s%s=%s", envPrefix, name, value)
+}
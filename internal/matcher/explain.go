@@ -0,0 +1,62 @@
+package matcher
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+// Explanation tells whether a matcher would execute its command for an alert
+// group, and why not when it wouldn't
+type Explanation struct {
+	Matcher  string
+	Selected bool
+	Reason   string
+}
+
+func (m matcherMap) Explain(ag internal.AlertGroup) []Explanation {
+	selected := make(map[string]bool)
+	for _, match := range m.Match(ag) {
+		selected[match.Name()] = true
+	}
+
+	explanations := make([]Explanation, 0, len(m.matchers))
+	for _, matcher := range m.matchers {
+		e := Explanation{
+			Matcher:  matcher.matcherName,
+			Selected: selected[matcher.matcherName],
+			Reason:   matcher.explain(ag),
+		}
+		if e.Reason == "" && !e.Selected {
+			e.Reason = "a previous matcher matched first"
+			if m.route != nil {
+				e.Reason = "it is not executed by the routing tree"
+			}
+		}
+		explanations = append(explanations, e)
+	}
+	return explanations
+}
+
+// explain returns why the matcher does not match the alert group, or an empty
+// string if it does
+func (m oneAlertMatcher) explain(ag internal.AlertGroup) string {
+	if m.mode != internal.PerAlertMode {
+		return m.mismatch(ag, ag.Status, ag.CommonLabels, ag.CommonAnnotations)
+	}
+
+	if len(ag.Alerts) == 0 {
+		return "there are no alerts in the group"
+	}
+
+	reasons := make([]string, 0, len(ag.Alerts))
+	for i, alert := range ag.Alerts {
+		reason := m.mismatch(ag, alert.Status, alert.Labels, alert.Annotations)
+		if reason == "" {
+			return ""
+		}
+		reasons = append(reasons, fmt.Sprintf("alert %d: %s", i, reason))
+	}
+	return strings.Join(reasons, ", ")
+}
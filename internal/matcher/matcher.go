@@ -5,61 +5,241 @@ import (
 	"fmt"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/labels"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/timeinterval"
 )
 
 // New creates a new Matcher with the provided configuration.
 //
 // May return an error if we fail to load the configuration
 func New(cnf internal.Configuration) (Matcher, error) {
+	intervals, err := newTimeIntervals(cnf.TimeIntervals)
+	if err != nil {
+		return nil, err
+	}
+
 	am := make([]*oneAlertMatcher, 0)
-	for _, m := range cnf.Matchers {
-		matcher, err := newAlertMatcher(m)
+	for i, m := range cnf.Matchers {
+		matcher, err := newAlertMatcher(i, m, intervals)
 		if err != nil {
+			if m.File != "" {
+				return nil, fmt.Errorf("%s: %s", m.File, err)
+			}
 			return nil, err
 		}
 		am = append(am, matcher)
 	}
 
+	var root *route
+	if cnf.Route != nil {
+		byName := make(map[string]*oneAlertMatcher)
+		for _, m := range am {
+			if _, ok := byName[m.matcherName]; !ok {
+				byName[m.matcherName] = m
+			}
+		}
+
+		r, err := newRoute(*cnf.Route, byName)
+		if err != nil {
+			return nil, err
+		}
+		root = r
+	}
+
 	return matcherMap{
 		matchers: am,
+		route:    root,
 	}, nil
 }
 
+// MatcherError is an error in one of the matchers of the configuration, Index
+// is the position of the matcher and Key the configuration key the error was
+// found in, empty when it's not known
+type MatcherError struct {
+	Index int
+	Key   string
+	Err   error
+}
+
+func (e *MatcherError) Error() string {
+	return e.Err.Error()
+}
+
+// Validate returns the errors of every matcher of the configuration as
+// MatcherErrors, where New stops at the first one, along with the errors of
+// the time intervals and the routing tree
+func Validate(cnf internal.Configuration) []error {
+	errs := make([]error, 0)
+
+	// Without the time intervals every matcher that uses them would fail
+	intervals, err := newTimeIntervals(cnf.TimeIntervals)
+	if err != nil {
+		return append(errs, err)
+	}
+
+	byName := make(map[string]*oneAlertMatcher)
+	for i, mc := range cnf.Matchers {
+		m, err := newAlertMatcher(i, mc, intervals)
+		if err != nil {
+			e := &MatcherError{Index: i, Err: err}
+			if ke, ok := err.(keyError); ok {
+				e.Key = ke.key
+			}
+			errs = append(errs, e)
+			continue
+		}
+		if _, ok := byName[m.matcherName]; !ok {
+			byName[m.matcherName] = m
+		}
+	}
+
+	// The routing tree would fail for the matchers that are not valid
+	if cnf.Route != nil && len(errs) == 0 {
+		if _, err := newRoute(*cnf.Route, byName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func newTimeIntervals(cnf []internal.TimeIntervalConfiguration) (map[string]*timeinterval.TimeInterval, error) {
+	intervals := make(map[string]*timeinterval.TimeInterval)
+	for _, c := range cnf {
+		ti, err := timeinterval.New(c)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := intervals[ti.Name]; ok {
+			return nil, fmt.Errorf("Time interval %s is defined more than once", ti.Name)
+		}
+		intervals[ti.Name] = ti
+	}
+	return intervals, nil
+}
+
 // Matcher is the interface of the whatever loads the configuration and then is
 // used to match an alert to an executor
 type Matcher interface {
-	Match(internal.AlertGroup) Match
+	Match(internal.AlertGroup) []Match
+
+	// Get returns the match that the named matcher would produce for the alert
+	// group, or the alert when matching each alert on its own, without checking
+	// if it actually matches. Returns nil if there is no such matcher
+	Get(name string, ag internal.AlertGroup, alert *internal.Alert) Match
+
+	// Explain returns whether each matcher would execute its command for the
+	// alert group, without executing anything
+	Explain(internal.AlertGroup) []Explanation
 }
 
 type oneAlertMatcher struct {
 	matcherName string
+	file        string
 	labels      map[string]*regexp.Regexp
 	annotations map[string]*regexp.Regexp
+	matchers    []*labels.Matcher
+	statuses    map[string]bool
+	mode        string
+
+	receiver        *regexp.Regexp
+	groupLabels     map[string]*regexp.Regexp
+	externalURL     *regexp.Regexp
+	minFiringAlerts int
+	minFiring       time.Duration
+
+	activeIntervals []*timeinterval.TimeInterval
+	muteIntervals   []*timeinterval.TimeInterval
+
+	approvalTimeout time.Duration
+	dryRun          bool
 
 	template *internal.MessageTemplate
 	cmd      string
 	args     []string
 
+	resolvedCmd  string
+	resolvedArgs []string
+
 	timeout int
+	retry   RetryPolicy
+	env     map[string]string
+	context alertContextPolicy
+	params  map[string]parameter
+
+	cooldown       time.Duration
+	cooldownLabels []string
+}
+
+// acceptsStatus returns true when the matcher reacts to the given status,
+// which is any status when none has been configured
+func (m oneAlertMatcher) acceptsStatus(status string) bool {
+	if status == internal.ResolvedStatus && m.resolvedCmd != "" {
+		return true
+	}
+	if len(m.statuses) == 0 {
+		return true
+	}
+	return m.statuses[status]
 }
 
-func (m oneAlertMatcher) Match(ag internal.AlertGroup) bool {
+// Match returns the matches for the alert group, which will be one at most
+// when matching the whole group, or one per matching alert otherwise
+func (m oneAlertMatcher) Match(ag internal.AlertGroup) []Match {
+	if m.mode == internal.PerAlertMode {
+		matches := make([]Match, 0)
+		for i := range ag.Alerts {
+			alert := ag.Alerts[i]
+			if m.matches(ag, alert.Status, alert.Labels, alert.Annotations) {
+				matches = append(matches, m.newExecutor(ag, alert.Status, &alert))
+			}
+		}
+		return matches
+	}
+
+	if m.matches(ag, ag.Status, ag.CommonLabels, ag.CommonAnnotations) {
+		return []Match{m.newExecutor(ag, ag.Status, nil)}
+	}
+	return nil
+}
+
+func (m oneAlertMatcher) matches(ag internal.AlertGroup, status string,
+	labels, annotations map[string]string) bool {
+	return m.mismatch(ag, status, labels, annotations) == ""
+}
+
+// mismatch returns why the alert does not match, or an empty string if it does
+func (m oneAlertMatcher) mismatch(ag internal.AlertGroup, status string,
+	labels, annotations map[string]string) string {
+	if !m.acceptsStatus(status) {
+		log.WithFields(log.Fields{
+			"alertgroup": ag,
+			"status":     status,
+			"matcher":    m.matcherName,
+		}).Debugf("alert status is not handled by matcher")
+		return fmt.Sprintf("status %s is not handled", status)
+	}
+
+	if reason := m.groupMismatch(ag, status); reason != "" {
+		return reason
+	}
+
 	for name, regex := range m.annotations {
-		value, ok := ag.CommonAnnotations[name]
+		value, ok := annotations[name]
 		if !ok {
 			log.WithFields(log.Fields{
 				"alertgroup": ag,
 				"annotation": name,
 				"matcher":    m.matcherName,
 			}).Debugf("alert does not contain expected annotation")
-			return false
+			return fmt.Sprintf("annotation %s is missing", name)
 		}
 		if !regex.MatchString(value) {
 			log.WithField("alertgroup", ag).
@@ -67,19 +247,19 @@ func (m oneAlertMatcher) Match(ag internal.AlertGroup) bool {
 				WithField("value", value).
 				WithField("matcher", m.matcherName).
 				Debugf("alert does not match expected regex for annotation")
-			return false
+			return fmt.Sprintf("annotation %s=%q does not match %s", name, value, regex)
 		}
 	}
 
 	for name, regex := range m.labels {
-		value, ok := ag.CommonLabels[name]
+		value, ok := labels[name]
 		if !ok {
 			log.WithFields(log.Fields{
 				"alertgroup": ag,
 				"label":      name,
 				"matcher":    m.matcherName,
 			}).Debugf("alert does not contain expected label")
-			return false
+			return fmt.Sprintf("label %s is missing", name)
 		}
 		if !regex.MatchString(value) {
 			log.WithField("alertgroup", ag).
@@ -87,7 +267,19 @@ func (m oneAlertMatcher) Match(ag internal.AlertGroup) bool {
 				WithField("value", value).
 				WithField("matcher", m.matcherName).
 				Debugf("alert does not match expected regex for label")
-			return false
+			return fmt.Sprintf("label %s=%q does not match %s", name, value, regex)
+		}
+	}
+
+	for _, matcher := range m.matchers {
+		if !matcher.Matches(labels[matcher.Name]) {
+			log.WithField("alertgroup", ag).
+				WithField("label", matcher.Name).
+				WithField("value", labels[matcher.Name]).
+				WithField("labelmatcher", matcher.String()).
+				WithField("matcher", m.matcherName).
+				Debugf("alert does not match expected label matcher")
+			return fmt.Sprintf("label %s=%q does not match %s", matcher.Name, labels[matcher.Name], matcher)
 		}
 	}
 
@@ -95,77 +287,379 @@ func (m oneAlertMatcher) Match(ag internal.AlertGroup) bool {
 		WithField("matcher", m).
 		Debugf("alert matched")
 
-	return true
+	return ""
+}
+
+// groupMismatch checks the attributes of the whole alert group, which apply the
+// same way when matching each alert on its own
+func (m oneAlertMatcher) groupMismatch(ag internal.AlertGroup, status string) string {
+	if m.receiver != nil && !m.receiver.MatchString(ag.Receiver) {
+		log.WithFields(log.Fields{
+			"alertgroup": ag,
+			"receiver":   ag.Receiver,
+			"matcher":    m.matcherName,
+		}).Debugf("alert group does not match expected regex for receiver")
+		return fmt.Sprintf("receiver %q does not match %s", ag.Receiver, m.receiver)
+	}
+
+	if m.externalURL != nil && !m.externalURL.MatchString(ag.ExternalURL) {
+		log.WithFields(log.Fields{
+			"alertgroup":  ag,
+			"externalURL": ag.ExternalURL,
+			"matcher":     m.matcherName,
+		}).Debugf("alert group does not match expected regex for external url")
+		return fmt.Sprintf("external url %q does not match %s", ag.ExternalURL, m.externalURL)
+	}
+
+	for name, regex := range m.groupLabels {
+		value, ok := ag.GroupLabels[name]
+		if !ok || !regex.MatchString(value) {
+			log.WithFields(log.Fields{
+				"alertgroup": ag,
+				"label":      name,
+				"value":      value,
+				"matcher":    m.matcherName,
+			}).Debugf("alert group does not match expected regex for group label")
+			return fmt.Sprintf("group label %s=%q does not match %s", name, value, regex)
+		}
+	}
+
+	if status == internal.FiringStatus && m.minFiringAlerts > 0 {
+		firing := 0
+		for _, alert := range ag.Alerts {
+			if alert.Status == internal.FiringStatus {
+				firing++
+			}
+		}
+		if firing < m.minFiringAlerts {
+			log.WithFields(log.Fields{
+				"alertgroup": ag,
+				"firing":     firing,
+				"matcher":    m.matcherName,
+			}).Debugf("alert group does not have enough firing alerts")
+			return fmt.Sprintf("only %d of the required %d alerts are firing", firing, m.minFiringAlerts)
+		}
+	}
+
+	return ""
 }
 
 type matcherMap struct {
 	matchers []*oneAlertMatcher
+	route    *route
 }
 
-func (m matcherMap) Match(ag internal.AlertGroup) Match {
+func (m matcherMap) Match(ag internal.AlertGroup) []Match {
+	if m.route != nil {
+		return m.matchRoutes(ag)
+	}
+
 	for _, matcher := range m.matchers {
-		if matcher.Match(ag) {
+		matches := matcher.Match(ag)
+		if len(matches) > 0 {
+			matched(ag, matcher, matches)
+			return matches
+		}
+	}
 
-			metrics.AlertsMatchedToCommand.
-				WithLabelValues(matcher.matcherName).Inc()
+	metrics.AlertsMissed.Inc()
 
-			log.WithFields(log.Fields{
-				"alertgroup": ag,
-				"matcher":    matcher}).
-				Debugf("matched alergroup")
-
-			return cmdExecutor{
-				template:    matcher.template,
-				matcherName: matcher.matcherName,
-				cmd:         matcher.cmd,
-				args:        matcher.args,
-				timeout:     time.Duration(matcher.timeout) * time.Second,
+	return nil
+}
+
+// matchRoutes walks the routing tree and executes every matcher of the routes
+// that apply to the alert group, each matcher runs at most once
+func (m matcherMap) matchRoutes(ag internal.AlertGroup) []Match {
+	seen := make(map[string]bool)
+	all := make([]Match, 0)
+	for _, r := range m.route.match(ag.CommonLabels) {
+		for _, matcher := range r.execute {
+			if seen[matcher.matcherName] {
+				continue
+			}
+			seen[matcher.matcherName] = true
+
+			matches := matcher.Match(ag)
+			if len(matches) > 0 {
+				matched(ag, matcher, matches)
+				all = append(all, matches...)
 			}
 		}
 	}
 
-	metrics.AlertsMissed.Inc()
+	if len(all) == 0 {
+		metrics.AlertsMissed.Inc()
+		return nil
+	}
+	return all
+}
 
+func matched(ag internal.AlertGroup, matcher *oneAlertMatcher, matches []Match) {
+	metrics.AlertsMatchedToCommand.
+		WithLabelValues(matcher.matcherName).Add(float64(len(matches)))
+
+	log.WithFields(log.Fields{
+		"alertgroup": ag,
+		"matches":    len(matches),
+		"matcher":    matcher,
+		"file":       matcher.file}).
+		Debugf("matched alergroup")
+}
+
+func (m matcherMap) Get(name string, ag internal.AlertGroup, alert *internal.Alert) Match {
+	for _, matcher := range m.matchers {
+		if matcher.matcherName != name {
+			continue
+		}
+
+		status := ag.Status
+		if alert != nil {
+			status = alert.Status
+		}
+		return matcher.newExecutor(ag, status, alert)
+	}
 	return nil
 }
 
+// newExecutor returns the executor for the given status, which will be the
+// resolved command if there is one and the alert has been resolved.
+//
+// The alert is only set when matching each alert on its own
+func (m oneAlertMatcher) newExecutor(ag internal.AlertGroup, status string, alert *internal.Alert) cmdExecutor {
+	e := cmdExecutor{
+		template:    m.template,
+		matcherName: m.matcherName,
+		file:        m.file,
+		alert:       alert,
+		event:       internal.MatchEvent,
+		cmd:         m.cmd,
+		args:        m.args,
+		timeout:     time.Duration(m.timeout) * time.Second,
+		retry:       m.retry,
+		env:         m.env,
+		context:     m.context,
+		params:      m.params,
+		alertGroup:  ag,
+
+		activeIntervals: m.activeIntervals,
+		muteIntervals:   m.muteIntervals,
+
+		approvalTimeout: m.approvalTimeout,
+		dryRun:          m.dryRun,
+	}
+
+	if status == internal.ResolvedStatus && m.resolvedCmd != "" {
+		e.event = internal.ResolvedEvent
+		e.cmd = m.resolvedCmd
+		e.args = m.resolvedArgs
+	}
+
+	if status == internal.FiringStatus {
+		e.minFiring = m.minFiring
+	}
+
+	if m.cooldown > 0 {
+		e.cooldown = m.cooldown
+		e.cooldownKey = m.cooldownKey(ag, e.event, alert)
+	}
+
+	return e
+}
+
+// cooldownKey builds the key used to deduplicate executions, which is built
+// with the configured labels, or with the group key when matching the whole
+// group and all the alert labels when matching each alert on its own
+func (m oneAlertMatcher) cooldownKey(ag internal.AlertGroup, event internal.Event, alert *internal.Alert) string {
+	labels := ag.CommonLabels
+	if alert != nil {
+		labels = alert.Labels
+	}
+
+	names := m.cooldownLabels
+	if len(names) == 0 {
+		if alert == nil {
+			return fmt.Sprintf("%s/%s/%s", m.matcherName, event, ag.GroupKey)
+		}
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return fmt.Sprintf("%s/%s/{%s}", m.matcherName, event, strings.Join(pairs, ","))
+}
+
 // Match represents a unit of work
 type Match interface {
 	Name() string
+	Alert() *internal.Alert
+	Event() internal.Event
 	Template() *internal.MessageTemplate
+	Cooldown() (string, time.Duration)
+	Deferred(now time.Time) bool
+	Muted(now time.Time) bool
+	Approval() time.Duration
+	DryRun() bool
+	Retry() RetryPolicy
 	Execute() (string, error)
 }
 
 type cmdExecutor struct {
 	template    *internal.MessageTemplate
 	matcherName string
+	file        string
+	alert       *internal.Alert
+	event       internal.Event
 	cmd         string
 	args        []string
 	timeout     time.Duration
+	retry       RetryPolicy
+	env         map[string]string
+	context     alertContextPolicy
+	params      map[string]parameter
+	alertGroup  internal.AlertGroup
+
+	cooldownKey string
+	cooldown    time.Duration
+
+	minFiring time.Duration
+
+	activeIntervals []*timeinterval.TimeInterval
+	muteIntervals   []*timeinterval.TimeInterval
+
+	approvalTimeout time.Duration
+	dryRun          bool
 }
 
 func (c cmdExecutor) Name() string {
 	return c.matcherName
 }
 
+// Alert returns the alert that was matched when matching each alert on its
+// own, or nil when the whole group was matched
+func (c cmdExecutor) Alert() *internal.Alert {
+	return c.alert
+}
+
+// Event returns the event to announce before executing, which is a match
+// event unless the command is being executed because the alert was resolved
+func (c cmdExecutor) Event() internal.Event {
+	return c.event
+}
+
 func (c cmdExecutor) Template() *internal.MessageTemplate {
 	return c.template
 }
 
+// Cooldown returns the key used to deduplicate executions and how long to skip
+// the executions with the same key for, which is zero when there's no cooldown
+func (c cmdExecutor) Cooldown() (string, time.Duration) {
+	return c.cooldownKey, c.cooldown
+}
+
+// Deferred returns true when the matched alerts have not been firing for the
+// minimum duration yet, checking all the firing alerts in the group when
+// matching the whole group
+func (c cmdExecutor) Deferred(now time.Time) bool {
+	if c.minFiring == 0 {
+		return false
+	}
+
+	alerts := c.alertGroup.Alerts
+	if c.alert != nil {
+		alerts = internal.Alerts{*c.alert}
+	}
+
+	for _, alert := range alerts {
+		if alert.Status != internal.FiringStatus || alert.StartsAt.IsZero() {
+			continue
+		}
+		if now.Sub(alert.StartsAt) < c.minFiring {
+			return true
+		}
+	}
+	return false
+}
+
+// Muted returns true when the time is outside all the active time intervals,
+// if there are any, or inside any of the mute time intervals
+func (c cmdExecutor) Muted(now time.Time) bool {
+	for _, ti := range c.muteIntervals {
+		if ti.Contains(now) {
+			return true
+		}
+	}
+
+	for _, ti := range c.activeIntervals {
+		if ti.Contains(now) {
+			return false
+		}
+	}
+	return len(c.activeIntervals) > 0
+}
+
+// Approval returns how long to wait for the execution to be approved, which is
+// zero when it doesn't require approval
+func (c cmdExecutor) Approval() time.Duration {
+	return c.approvalTimeout
+}
+
+// DryRun returns true when the command is not actually executed
+func (c cmdExecutor) DryRun() bool {
+	return c.dryRun
+}
+
+// Retry returns the policy to follow when the execution fails
+func (c cmdExecutor) Retry() RetryPolicy {
+	return c.retry
+}
+
 func (c cmdExecutor) Execute() (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
+	args, err := c.expandArgs()
+	if err != nil {
+		log.WithField("cmd", c.cmd).
+			WithField("matcher", c.matcherName).
+			WithField("error", err).
+			Error("Command execution rejected")
+
+		metrics.CommandsRejected.WithLabelValues(c.matcherName).Inc()
+		return "", err
+	}
+
+	if c.dryRun {
+		log.WithField("cmd", c.cmd).
+			WithField("matcher", c.matcherName).
+			WithField("args", strings.Join(args, ",")).
+			Info("Dry run, not executing command")
+
+		metrics.CommandsSimulated.WithLabelValues(c.matcherName).Inc()
+		return fmt.Sprintf("dry run: %s", strings.Join(append([]string{c.cmd}, args...), " ")), nil
+	}
+
 	startTime := time.Now()
-	cmd := exec.CommandContext(ctx, c.cmd, c.args...)
-	b, err := cmd.CombinedOutput()
+	cmd := exec.CommandContext(ctx, c.cmd, args...)
+
+	cleanup, err := c.prepare(cmd)
+	defer cleanup()
+
+	var b []byte
+	if err == nil {
+		b, err = cmd.CombinedOutput()
+	}
 	executionTime := time.Now().Sub(startTime)
 
 	output := fmt.Sprintf("%s", b)
 	logger := log.WithField("output", output).
 		WithField("cmd", c.cmd).
 		WithField("matcher", c.matcherName).
-		WithField("args", strings.Join(c.args, ","))
+		WithField("args", strings.Join(args, ","))
 
 	if err != nil {
 		logger.WithField("error", err).
@@ -182,45 +676,225 @@ func (c cmdExecutor) Execute() (string, error) {
 	return output, nil
 }
 
-func newAlertMatcher(mc internal.MatcherConfiguration) (*oneAlertMatcher, error) {
+// ExitCode returns the exit code of the error returned by executing a match,
+// which is 0 when there is no error, and -1 when the command did not exit on
+// its own or could not be started
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// keyError is an error in the value of a key of the matcher configuration
+type keyError struct {
+	key string
+	err error
+}
+
+func (e keyError) Error() string {
+	return e.err.Error()
+}
+
+func invalid(key, format string, args ...interface{}) error {
+	return keyError{key, fmt.Errorf(format, args...)}
+}
+
+// defaultApprovalTimeout is how long a match waits to be approved when the
+// matcher does not configure it
+const defaultApprovalTimeout = time.Hour
+
+// newAlertMatcher builds the matcher at the given index of the configuration.
+//
+// The configuration must not be part of the errors, as it contains the
+// secrets expanded in the command, arguments and environment
+func newAlertMatcher(index int, mc internal.MatcherConfiguration, intervals map[string]*timeinterval.TimeInterval) (*oneAlertMatcher, error) {
 
 	if strings.TrimSpace(mc.Name) == "" {
-		return nil, fmt.Errorf("Metric name can't be empty in %#v", mc)
+		return nil, invalid("name", "Metric name can't be empty in matcher number %d", index+1)
 	}
 	if strings.TrimSpace(mc.Command) == "" {
-		return nil, fmt.Errorf("Command can't be empty in %#v", mc)
+		return nil, invalid("command", "Command can't be empty in matcher %s", mc.Name)
+	}
+
+	statuses := make(map[string]bool)
+	for _, status := range mc.Statuses {
+		if status != internal.FiringStatus && status != internal.ResolvedStatus {
+			return nil, invalid("statuses", "Invalid status %s in matcher %s, only %s and %s are supported",
+				status, mc.Name, internal.FiringStatus, internal.ResolvedStatus)
+		}
+		statuses[status] = true
+	}
+
+	mode := mc.Mode
+	if mode == "" {
+		mode = internal.GroupMode
+	}
+	if mode != internal.GroupMode && mode != internal.PerAlertMode {
+		return nil, invalid("mode", "Invalid mode %s in matcher %s, only %s and %s are supported",
+			mode, mc.Name, internal.GroupMode, internal.PerAlertMode)
 	}
 
-	labels := make(map[string]*regexp.Regexp)
+	labelRegexes := make(map[string]*regexp.Regexp)
 	for l, r := range mc.Labels {
 		reg, err := regexp.Compile(r)
 		if err != nil {
-			return nil, fmt.Errorf("Failed to compile regex for label %s (%s): %s", l, r, err)
+			return nil, invalid("labels", "Failed to compile regex for label %s (%s): %s", l, r, err)
+		}
+		labelRegexes[l] = reg
+	}
+
+	matchers := make([]*labels.Matcher, 0)
+	for _, s := range mc.Matchers {
+		ms, err := labels.ParseMatchers(s)
+		if err != nil {
+			return nil, invalid("matchers", "Failed to parse matchers in matcher %s: %s", mc.Name, err)
 		}
-		labels[l] = reg
+		matchers = append(matchers, ms...)
 	}
 
 	annotations := make(map[string]*regexp.Regexp)
 	for a, r := range mc.Annotations {
 		reg, err := regexp.Compile(r)
 		if err != nil {
-			return nil, fmt.Errorf("Failed to compile regex for annotation %s (%s): %s", a, r, err)
+			return nil, invalid("annotations", "Failed to compile regex for annotation %s (%s): %s", a, r, err)
 		}
 		annotations[a] = reg
 	}
+	if mc.CooldownSeconds < 0 {
+		return nil, invalid("cooldown_seconds", "Cooldown can't be negative in matcher %s", mc.Name)
+	}
+
+	groupLabels := make(map[string]*regexp.Regexp)
+	for l, r := range mc.GroupLabels {
+		reg, err := regexp.Compile(r)
+		if err != nil {
+			return nil, invalid("group_labels", "Failed to compile regex for group label %s (%s): %s", l, r, err)
+		}
+		groupLabels[l] = reg
+	}
+
+	var receiver *regexp.Regexp
+	if mc.Receiver != "" {
+		reg, err := regexp.Compile(mc.Receiver)
+		if err != nil {
+			return nil, invalid("receiver", "Failed to compile regex for receiver (%s): %s", mc.Receiver, err)
+		}
+		receiver = reg
+	}
+
+	var externalURL *regexp.Regexp
+	if mc.ExternalURL != "" {
+		reg, err := regexp.Compile(mc.ExternalURL)
+		if err != nil {
+			return nil, invalid("external_url", "Failed to compile regex for external url (%s): %s", mc.ExternalURL, err)
+		}
+		externalURL = reg
+	}
+
+	if mc.MinFiringAlerts < 0 {
+		return nil, invalid("min_firing_alerts", "Minimum firing alerts can't be negative in matcher %s", mc.Name)
+	}
+	if mc.MinFiringSeconds < 0 {
+		return nil, invalid("min_firing_seconds", "Minimum firing duration can't be negative in matcher %s", mc.Name)
+	}
+
+	if mc.ApprovalTimeoutSeconds < 0 {
+		return nil, invalid("approval_timeout_seconds", "Approval timeout can't be negative in matcher %s", mc.Name)
+	}
+	var approvalTimeout time.Duration
+	if mc.RequireApproval {
+		approvalTimeout = defaultApprovalTimeout
+		if mc.ApprovalTimeoutSeconds > 0 {
+			approvalTimeout = time.Duration(mc.ApprovalTimeoutSeconds) * time.Second
+		}
+	}
+
+	activeIntervals, err := lookupTimeIntervals(mc.Name, mc.ActiveTimeIntervals, intervals)
+	if err != nil {
+		return nil, keyError{"active_time_intervals", err}
+	}
+	muteIntervals, err := lookupTimeIntervals(mc.Name, mc.MuteTimeIntervals, intervals)
+	if err != nil {
+		return nil, keyError{"mute_time_intervals", err}
+	}
+
+	retry, err := newRetryPolicy(mc.Name, mc.Retry)
+	if err != nil {
+		return nil, keyError{"retry", err}
+	}
+
+	alertContext, err := newAlertContextPolicy(mc.Name, mc.AlertContext)
+	if err != nil {
+		return nil, keyError{"alert_context", err}
+	}
+
+	params, err := newParameters(mc.Name, mc.Parameters, mc.Arguments, mc.ResolvedArguments)
+	if err != nil {
+		return nil, keyError{"params", err}
+	}
+
+	for name := range mc.Env {
+		if !validEnvName.MatchString(name) {
+			return nil, invalid("env", "Invalid environment variable name %s in matcher %s", name, mc.Name)
+		}
+	}
+
 	timeout := mc.Timeout
 	if timeout == 0 {
 		timeout = 30 // By default, 30 seconds of command execution timeout
 	}
 
 	return &oneAlertMatcher{
-		labels:      labels,
+		labels:      labelRegexes,
 		annotations: annotations,
+		matchers:    matchers,
+		statuses:    statuses,
+		mode:        mode,
+
+		receiver:        receiver,
+		groupLabels:     groupLabels,
+		externalURL:     externalURL,
+		minFiringAlerts: mc.MinFiringAlerts,
+		minFiring:       time.Duration(mc.MinFiringSeconds) * time.Second,
+
+		activeIntervals: activeIntervals,
+		muteIntervals:   muteIntervals,
+
+		approvalTimeout: approvalTimeout,
+		dryRun:          mc.DryRun,
 
 		matcherName: strings.TrimSpace(mc.Name),
+		file:        mc.File,
 		template:    mc.Template,
 		cmd:         mc.Command,
 		args:        mc.Arguments,
 		timeout:     timeout,
+		retry:       retry,
+		env:         mc.Env,
+		context:     alertContext,
+		params:      params,
+
+		resolvedCmd:  strings.TrimSpace(mc.ResolvedCommand),
+		resolvedArgs: mc.ResolvedArguments,
+
+		cooldown:       time.Duration(mc.CooldownSeconds) * time.Second,
+		cooldownLabels: mc.CooldownLabels,
 	}, nil
 }
+
+func lookupTimeIntervals(matcher string, names []string,
+	intervals map[string]*timeinterval.TimeInterval) ([]*timeinterval.TimeInterval, error) {
+	found := make([]*timeinterval.TimeInterval, 0, len(names))
+	for _, name := range names {
+		ti, ok := intervals[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown time interval %s in matcher %s", name, matcher)
+		}
+		found = append(found, ti)
+	}
+	return found, nil
+}
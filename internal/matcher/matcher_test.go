@@ -1,7 +1,10 @@
 package matcher_test
 
 import (
+	"fmt"
+	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -29,7 +32,7 @@ func TestNewMatchers(t *testing.T) {
 					},
 				},
 			},
-			`Metric name can't be empty in internal.MatcherConfiguration{Name:"", Labels:map[string]string(nil), Annotations:map[string]string(nil), Command:"echo", Arguments:[]string(nil)}`,
+			"Metric name can't be empty in matcher number 1",
 		}, {
 			"empty cmd fails",
 			internal.Configuration{
@@ -39,7 +42,7 @@ func TestNewMatchers(t *testing.T) {
 					},
 				},
 			},
-			`Command can't be empty in internal.MatcherConfiguration{Name:"somename", Labels:map[string]string(nil), Annotations:map[string]string(nil), Command:"", Arguments:[]string(nil)}`,
+			"Command can't be empty in matcher somename",
 		},
 		{
 			"one label and one configuration",
@@ -293,10 +296,10 @@ func TestMatching(t *testing.T) {
 			ex := m.Match(tt.alertGroup)
 
 			if tt.matches {
-				a.NotNil(ex)
-				ex.Execute()
+				a.Len(ex, 1)
+				ex[0].Execute()
 			} else {
-				a.Nil(ex)
+				a.Empty(ex)
 			}
 		})
 	}
@@ -331,8 +334,1164 @@ func TestCommandExecutionFails(t *testing.T) {
 
 			ex := m.Match(tt.alertGroup)
 
-			a.NotNil(ex)
-			ex.Execute()
+			a.Len(ex, 1)
+			ex[0].Execute()
 		})
 	}
 }
+
+func TestMatchingStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		matcher    internal.MatcherConfiguration
+		status     string
+		matches    bool
+		event      internal.Event
+		executable string
+	}{
+		{
+			"no statuses matches firing",
+			internal.MatcherConfiguration{},
+			"firing",
+			true,
+			internal.MatchEvent,
+			"echo",
+		},
+		{
+			"no statuses matches resolved",
+			internal.MatcherConfiguration{},
+			"resolved",
+			true,
+			internal.MatchEvent,
+			"echo",
+		},
+		{
+			"firing status matches firing",
+			internal.MatcherConfiguration{
+				Statuses: []string{"firing"},
+			},
+			"firing",
+			true,
+			internal.MatchEvent,
+			"echo",
+		},
+		{
+			"firing status does not match resolved",
+			internal.MatcherConfiguration{
+				Statuses: []string{"firing"},
+			},
+			"resolved",
+			false,
+			"",
+			"",
+		},
+		{
+			"resolved command matches resolved",
+			internal.MatcherConfiguration{
+				Statuses:        []string{"firing"},
+				ResolvedCommand: "true",
+			},
+			"resolved",
+			true,
+			internal.ResolvedEvent,
+			"true",
+		},
+		{
+			"resolved command is not used for firing",
+			internal.MatcherConfiguration{
+				ResolvedCommand: "true",
+			},
+			"firing",
+			true,
+			internal.MatchEvent,
+			"echo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			tt.matcher.Name = "somename"
+			tt.matcher.Command = "echo"
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{tt.matcher},
+			})
+			a.NoError(err)
+
+			ex := m.Match(internal.AlertGroup{Status: tt.status})
+			if !tt.matches {
+				a.Empty(ex)
+				return
+			}
+
+			a.Len(ex, 1)
+			a.Equal(tt.event, ex[0].Event())
+			a.Contains(fmt.Sprintf("%#v", ex[0]), fmt.Sprintf("cmd:%q", tt.executable))
+		})
+	}
+}
+
+func TestInvalidStatusFails(t *testing.T) {
+	_, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:     "somename",
+				Command:  "echo",
+				Statuses: []string{"pending"},
+			},
+		},
+	})
+	assert.EqualError(t, err, "Invalid status pending in matcher somename, only firing and resolved are supported")
+}
+
+func TestPerAlertMode(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:     "per-alert",
+				Command:  "echo",
+				Mode:     "per_alert",
+				Statuses: []string{"firing"},
+				Labels: map[string]string{
+					"hostname": "^host-[0-9]+$",
+				},
+			},
+		},
+	})
+	a.NoError(err)
+
+	ex := m.Match(internal.AlertGroup{
+		Status: "firing",
+		CommonLabels: map[string]string{
+			"alertname": "HostDown",
+		},
+		Alerts: internal.Alerts{
+			{Status: "firing", Labels: map[string]string{"hostname": "host-1"}},
+			{Status: "resolved", Labels: map[string]string{"hostname": "host-2"}},
+			{Status: "firing", Labels: map[string]string{"hostname": "other"}},
+			{Status: "firing", Labels: map[string]string{"hostname": "host-3"}},
+		},
+	})
+
+	a.Len(ex, 2)
+	a.Equal("host-1", ex[0].Alert().Labels["hostname"])
+	a.Equal("host-3", ex[1].Alert().Labels["hostname"])
+}
+
+func TestGroupModeHasNoAlert(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:    "group",
+				Command: "echo",
+			},
+		},
+	})
+	a.NoError(err)
+
+	ex := m.Match(internal.AlertGroup{})
+	a.Len(ex, 1)
+	a.Nil(ex[0].Alert())
+}
+
+func TestValidateReportsEveryMatcher(t *testing.T) {
+	a := assert.New(t)
+
+	errs := matcher.Validate(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{Name: "status", Command: "echo", Statuses: []string{"pending"}},
+			{Name: "valid", Command: "echo"},
+			{Name: "retry", Command: "echo", Retry: &internal.RetryConfiguration{MaxAttempts: -1}},
+		},
+		Route: &internal.RouteConfiguration{Execute: []string{"missing"}},
+	})
+
+	if a.Len(errs, 2, "the route is not checked while matchers are invalid") {
+		a.Equal(0, errs[0].(*matcher.MatcherError).Index)
+		a.Equal("statuses", errs[0].(*matcher.MatcherError).Key)
+		a.Equal(2, errs[1].(*matcher.MatcherError).Index)
+		a.Equal("retry", errs[1].(*matcher.MatcherError).Key)
+	}
+
+	errs = matcher.Validate(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{{Name: "valid", Command: "echo"}},
+		Route:    &internal.RouteConfiguration{Execute: []string{"missing"}},
+	})
+	a.Len(errs, 1)
+}
+
+func TestInvalidModeFails(t *testing.T) {
+	_, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:    "somename",
+				Command: "echo",
+				Mode:    "per_host",
+			},
+		},
+	})
+	assert.EqualError(t, err, "Invalid mode per_host in matcher somename, only group and per_alert are supported")
+}
+
+func TestCooldownKeys(t *testing.T) {
+	ag := internal.AlertGroup{
+		GroupKey: "{}:{alertname=\"HostDown\"}",
+		Status:   "firing",
+		CommonLabels: map[string]string{
+			"alertname": "HostDown",
+			"team":      "infra",
+		},
+		Alerts: internal.Alerts{
+			{
+				Status: "firing",
+				Labels: map[string]string{"alertname": "HostDown", "hostname": "host-1"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		matcher  internal.MatcherConfiguration
+		status   string
+		key      string
+		cooldown time.Duration
+	}{
+		{
+			"no cooldown",
+			internal.MatcherConfiguration{},
+			"firing",
+			"",
+			0,
+		},
+		{
+			"group key by default",
+			internal.MatcherConfiguration{
+				CooldownSeconds: 60,
+			},
+			"firing",
+			"somename/match/{}:{alertname=\"HostDown\"}",
+			time.Minute,
+		},
+		{
+			"chosen labels",
+			internal.MatcherConfiguration{
+				CooldownSeconds: 60,
+				CooldownLabels:  []string{"team", "missing"},
+			},
+			"firing",
+			"somename/match/{team=\"infra\",missing=\"\"}",
+			time.Minute,
+		},
+		{
+			"all alert labels when matching each alert",
+			internal.MatcherConfiguration{
+				CooldownSeconds: 60,
+				Mode:            "per_alert",
+			},
+			"firing",
+			"somename/match/{alertname=\"HostDown\",hostname=\"host-1\"}",
+			time.Minute,
+		},
+		{
+			"resolved executions have their own key",
+			internal.MatcherConfiguration{
+				CooldownSeconds: 60,
+				Mode:            "per_alert",
+				CooldownLabels:  []string{"hostname"},
+				ResolvedCommand: "true",
+			},
+			"resolved",
+			"somename/resolved/{hostname=\"host-1\"}",
+			time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			tt.matcher.Name = "somename"
+			tt.matcher.Command = "echo"
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{tt.matcher},
+			})
+			a.NoError(err)
+
+			ag.Alerts[0].Status = tt.status
+			ag.Status = tt.status
+			ex := m.Match(ag)
+			a.Len(ex, 1)
+
+			key, cooldown := ex[0].Cooldown()
+			a.Equal(tt.key, key)
+			a.Equal(tt.cooldown, cooldown)
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:    "no-retry",
+				Command: "sh",
+				Labels:  map[string]string{"alertname": "^NoRetry$"},
+			},
+			{
+				Name:    "retry",
+				Command: "sh",
+				Labels:  map[string]string{"alertname": "^Retry$"},
+				Retry: &internal.RetryConfiguration{
+					MaxAttempts:           3,
+					InitialBackoffSeconds: 2,
+					MaxBackoffSeconds:     5,
+					RetryableExitCodes:    []int{75},
+				},
+			},
+		},
+	})
+	a.NoError(err)
+
+	noRetry := m.Match(internal.AlertGroup{CommonLabels: map[string]string{"alertname": "NoRetry"}})
+	a.Len(noRetry, 1)
+	a.Equal(1, noRetry[0].Retry().MaxAttempts)
+	a.False(noRetry[0].Retry().ShouldRetry(fmt.Errorf("failed"), 1))
+
+	ex := m.Match(internal.AlertGroup{CommonLabels: map[string]string{"alertname": "Retry"}})
+	a.Len(ex, 1)
+	policy := ex[0].Retry()
+
+	retryable := exec.Command("sh", "-c", "exit 75").Run()
+	notRetryable := exec.Command("sh", "-c", "exit 1").Run()
+
+	a.False(policy.ShouldRetry(nil, 1), "successful executions are not retried")
+	a.True(policy.ShouldRetry(retryable, 1))
+	a.True(policy.ShouldRetry(retryable, 2))
+	a.False(policy.ShouldRetry(retryable, 3), "attempts are exhausted")
+	a.False(policy.ShouldRetry(notRetryable, 1), "exit code is not retryable")
+
+	for attempt, limits := range map[int][]time.Duration{
+		1: {time.Second, 2 * time.Second},
+		2: {2 * time.Second, 4 * time.Second},
+		3: {2500 * time.Millisecond, 5 * time.Second},
+		9: {2500 * time.Millisecond, 5 * time.Second},
+	} {
+		backoff := policy.Backoff(attempt)
+		a.True(backoff >= limits[0] && backoff <= limits[1],
+			"backoff %s for attempt %d is out of %s", backoff, attempt, limits)
+	}
+}
+
+func TestInvalidRetryPolicyFails(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry internal.RetryConfiguration
+		err   string
+	}{
+		{
+			"no attempts",
+			internal.RetryConfiguration{},
+			"Retry max attempts must be at least 1 in matcher somename",
+		},
+		{
+			"negative backoff",
+			internal.RetryConfiguration{MaxAttempts: 2, InitialBackoffSeconds: -1},
+			"Retry backoff can't be negative in matcher somename",
+		},
+		{
+			"max backoff lower than initial",
+			internal.RetryConfiguration{MaxAttempts: 2, InitialBackoffSeconds: 10, MaxBackoffSeconds: 5},
+			"Retry max backoff can't be lower than the initial backoff in matcher somename",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{
+					{
+						Name:    "somename",
+						Command: "echo",
+						Retry:   &tt.retry,
+					},
+				},
+			})
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestAlertContext(t *testing.T) {
+	ag := internal.AlertGroup{
+		Status:   "firing",
+		GroupKey: "group",
+		CommonLabels: map[string]string{
+			"alertname": "HostDown",
+		},
+		Alerts: internal.Alerts{
+			{
+				Status: "firing",
+				Labels: map[string]string{
+					"alertname":  "HostDown",
+					"host-name":  "host-1; rm -rf /",
+					"multi_line": "first\nsecond",
+				},
+				Annotations: map[string]string{
+					"description": "a very long description",
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		matcher  internal.MatcherConfiguration
+		expected string
+	}{
+		{
+			"nothing is passed by default",
+			internal.MatcherConfiguration{
+				Arguments: []string{"-c", "echo \"$CAE_MATCHER\"; cat"},
+			},
+			"\n",
+		},
+		{
+			"static environment",
+			internal.MatcherConfiguration{
+				Arguments: []string{"-c", "echo $SOME_VAR"},
+				Env:       map[string]string{"SOME_VAR": "some value"},
+			},
+			"some value\n",
+		},
+		{
+			"labels and annotations as environment variables",
+			internal.MatcherConfiguration{
+				Mode:      "per_alert",
+				Arguments: []string{"-c", "echo \"$CAE_MATCHER $CAE_STATUS $CAE_LABEL_HOST_NAME $CAE_LABEL_MULTI_LINE $CAE_ANNOTATION_DESCRIPTION\""},
+				AlertContext: &internal.AlertContextConfiguration{
+					Env:            true,
+					MaxValueLength: 10,
+				},
+			},
+			"somename firing host-1; rm firstsecon a very lon\n",
+		},
+		{
+			"common labels when matching the whole group",
+			internal.MatcherConfiguration{
+				Arguments: []string{"-c", "echo \"$CAE_LABEL_ALERTNAME $CAE_LABEL_HOST_NAME\""},
+				AlertContext: &internal.AlertContextConfiguration{
+					Env: true,
+				},
+			},
+			"HostDown \n",
+		},
+		{
+			"context through stdin",
+			internal.MatcherConfiguration{
+				Arguments: []string{"-c", "cat"},
+				AlertContext: &internal.AlertContextConfiguration{
+					Stdin: true,
+				},
+			},
+			`{"matcher":"somename","alertGroup":{"version":"","groupKey":"group","receiver":"","status":"firing",` +
+				`"alerts":[{"status":"firing","labels":{"alertname":"HostDown","host-name":"host-1; rm -rf /","multi_line":"first\nsecond"},` +
+				`"annotations":{"description":"a very long description"},"startsAt":"0001-01-01T00:00:00Z","endsAt":"0001-01-01T00:00:00Z","generatorURL":""}],` +
+				`"groupLabels":null,"commonLabels":{"alertname":"HostDown"},"commonAnnotations":null,"externalURL":""}}`,
+		},
+		{
+			"context through a file",
+			internal.MatcherConfiguration{
+				Mode:      "per_alert",
+				Arguments: []string{"-c", "grep -o '\"alert\":{\"status\":\"firing\"' $CAE_ALERT_FILE"},
+				AlertContext: &internal.AlertContextConfiguration{
+					File: true,
+				},
+			},
+			"\"alert\":{\"status\":\"firing\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			tt.matcher.Name = "somename"
+			tt.matcher.Command = "sh"
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{tt.matcher},
+			})
+			a.NoError(err)
+
+			ex := m.Match(ag)
+			a.Len(ex, 1)
+
+			output, err := ex[0].Execute()
+			a.NoError(err)
+			a.Equal(tt.expected, output)
+		})
+	}
+}
+
+func TestInvalidEnvironmentFails(t *testing.T) {
+	_, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:    "somename",
+				Command: "echo",
+				Env:     map[string]string{"INVALID-NAME": "value"},
+			},
+		},
+	})
+	assert.EqualError(t, err, "Invalid environment variable name INVALID-NAME in matcher somename")
+}
+
+func TestParameters(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected string
+		err      string
+	}{
+		{
+			"valid values are substituted",
+			map[string]string{"hostname": "host-1", "service": "nginx"},
+			"restart nginx on host-1 --host=host-1\n",
+			"",
+		},
+		{
+			"invalid values are rejected",
+			map[string]string{"hostname": "host-1; rm -rf /", "service": "nginx"},
+			"",
+			`parameter host can't be extracted: value "host-1; rm -rf /" of label hostname is not valid`,
+		},
+		{
+			"missing labels are rejected",
+			map[string]string{"service": "nginx"},
+			"",
+			"parameter host can't be extracted: label hostname is missing or empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{
+					{
+						Name:      "somename",
+						Command:   "echo",
+						Arguments: []string{"restart", "%{service}", "on", "%{host}", "--host=%{host}"},
+						Parameters: []internal.ParameterConfiguration{
+							{Name: "host", Label: "hostname", Regex: "^[a-z0-9-]{1,63}$"},
+							{Name: "service", Label: "service", Regex: "^[a-z]+$"},
+						},
+						Retry: &internal.RetryConfiguration{MaxAttempts: 3},
+					},
+				},
+			})
+			a.NoError(err)
+
+			ex := m.Match(internal.AlertGroup{CommonLabels: tt.labels})
+			a.Len(ex, 1)
+
+			output, err := ex[0].Execute()
+			if tt.err == "" {
+				a.NoError(err)
+				a.Equal(tt.expected, output)
+			} else {
+				a.EqualError(err, tt.err)
+				a.False(ex[0].Retry().ShouldRetry(err, 1), "parameter errors are not retried")
+			}
+		})
+	}
+}
+
+func TestParameterAlternationsMatchTheWholeValue(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:      "somename",
+				Command:   "echo",
+				Arguments: []string{"%{host}"},
+				Parameters: []internal.ParameterConfiguration{
+					{Name: "host", Label: "hostname", Regex: "^[a-z]+|[0-9]+$"},
+				},
+			},
+		},
+	})
+	a.NoError(err)
+
+	for value, valid := range map[string]bool{
+		"abc":                  true,
+		"123":                  true,
+		"abc --rm -rf /; evil": false,
+		"evil; rm -rf / 123":   false,
+	} {
+		ex := m.Match(internal.AlertGroup{CommonLabels: map[string]string{"hostname": value}})
+		a.Len(ex, 1)
+
+		output, err := ex[0].Execute()
+		if valid {
+			a.NoError(err, value)
+			a.Equal(value+"\n", output)
+		} else {
+			a.EqualError(err, fmt.Sprintf("parameter host can't be extracted: value %q of label hostname is not valid", value))
+		}
+	}
+}
+
+func TestInvalidParametersFail(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []internal.ParameterConfiguration
+		args   []string
+		err    string
+	}{
+		{
+			"invalid name",
+			[]internal.ParameterConfiguration{{Name: "Host", Label: "hostname", Regex: "^.+$"}},
+			nil,
+			`Invalid parameter name "Host" in matcher somename`,
+		},
+		{
+			"duplicated name",
+			[]internal.ParameterConfiguration{
+				{Name: "host", Label: "hostname", Regex: "^.+$"},
+				{Name: "host", Label: "instance", Regex: "^.+$"},
+			},
+			nil,
+			"Duplicated parameter host in matcher somename",
+		},
+		{
+			"empty label",
+			[]internal.ParameterConfiguration{{Name: "host", Regex: "^.+$"}},
+			nil,
+			"Parameter host label can't be empty in matcher somename",
+		},
+		{
+			"unanchored regex",
+			[]internal.ParameterConfiguration{{Name: "host", Label: "hostname", Regex: "[a-z]+"}},
+			nil,
+			"Parameter host regex must be anchored with ^ and $ in matcher somename",
+		},
+		{
+			"invalid regex",
+			[]internal.ParameterConfiguration{{Name: "host", Label: "hostname", Regex: "^[$"}},
+			nil,
+			"Failed to compile regex for parameter host (^[$): error parsing regexp: missing closing ]: `[$`",
+		},
+		{
+			"undeclared parameter",
+			nil,
+			[]string{"%{host}"},
+			`Argument "%{host}" uses undeclared parameter "host" in matcher somename`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{
+					{
+						Name:       "somename",
+						Command:    "echo",
+						Arguments:  tt.args,
+						Parameters: tt.params,
+					},
+				},
+			})
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestLabelMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		matches bool
+	}{
+		{
+			"all matchers match",
+			map[string]string{"alertname": "PodIsStuck", "severity": "critical", "namespace": "a"},
+			true,
+		},
+		{
+			"negative matcher fails",
+			map[string]string{"alertname": "PodIsStuck", "severity": "info", "namespace": "a"},
+			false,
+		},
+		{
+			"set matcher fails",
+			map[string]string{"alertname": "PodIsStuck", "severity": "critical", "namespace": "c"},
+			false,
+		},
+		{
+			"absent label fails",
+			map[string]string{"alertname": "PodIsStuck", "severity": "critical", "namespace": "a", "silenced": "true"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{
+					{
+						Name:    "somename",
+						Command: "echo",
+						Matchers: []string{
+							`alertname="PodIsStuck"`,
+							`severity!="info", namespace=~"a|b"`,
+							`silenced=""`,
+						},
+					},
+				},
+			})
+			a.NoError(err)
+
+			ex := m.Match(internal.AlertGroup{CommonLabels: tt.labels})
+			if tt.matches {
+				a.Len(ex, 1)
+			} else {
+				a.Empty(ex)
+			}
+		})
+	}
+}
+
+func TestInvalidLabelMatchersFail(t *testing.T) {
+	_, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:     "somename",
+				Command:  "echo",
+				Matchers: []string{`severity=="info"`},
+			},
+		},
+	})
+	assert.EqualError(t, err, `Failed to parse matchers in matcher somename: `+
+		`invalid unquoted value in matcher "severity==\"info\"": it can't contain quotes`)
+}
+
+func TestRoutes(t *testing.T) {
+	cnf := internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{Name: "diagnose", Command: "echo"},
+			{Name: "remediate", Command: "echo"},
+			{Name: "fallback", Command: "echo"},
+		},
+		Route: &internal.RouteConfiguration{
+			Routes: []internal.RouteConfiguration{
+				{
+					Matchers: []string{`team="db"`},
+					Execute:  []string{"diagnose"},
+					Continue: true,
+				},
+				{
+					Matchers: []string{`team="db"`, `alertname="DiskFull"`},
+					Execute:  []string{"remediate"},
+				},
+				{
+					Matchers: []string{`team="web"`},
+					Routes: []internal.RouteConfiguration{
+						{
+							Matchers: []string{`severity="critical"`},
+							Execute:  []string{"remediate", "diagnose", "remediate"},
+						},
+					},
+				},
+				{
+					Execute: []string{"fallback"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected []string
+	}{
+		{
+			"continue executes the following routes",
+			map[string]string{"team": "db", "alertname": "DiskFull"},
+			[]string{"diagnose", "remediate"},
+		},
+		{
+			"continue falls through to the default route",
+			map[string]string{"team": "db", "alertname": "Other"},
+			[]string{"diagnose", "fallback"},
+		},
+		{
+			"nested routes inherit the parent constraints",
+			map[string]string{"team": "web", "severity": "critical"},
+			[]string{"remediate", "diagnose"},
+		},
+		{
+			"matching route without commands stops routing",
+			map[string]string{"team": "web", "severity": "info"},
+			[]string{},
+		},
+		{
+			"default route",
+			map[string]string{"team": "other"},
+			[]string{"fallback"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			m, err := matcher.New(cnf)
+			a.NoError(err)
+
+			names := make([]string, 0)
+			for _, ex := range m.Match(internal.AlertGroup{CommonLabels: tt.labels}) {
+				names = append(names, ex.Name())
+			}
+			a.Equal(tt.expected, names)
+		})
+	}
+}
+
+func TestInvalidRoutesFail(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    internal.RouteConfiguration
+		expected string
+	}{
+		{
+			"unknown matcher",
+			internal.RouteConfiguration{
+				Routes: []internal.RouteConfiguration{{Execute: []string{"missing"}}},
+			},
+			"Route executes unknown matcher missing",
+		},
+		{
+			"invalid matchers",
+			internal.RouteConfiguration{Matchers: []string{`team`}},
+			`Failed to parse matchers in route: invalid matcher "team", ` +
+				`it must be like name="value" with one of =, !=, =~ or !~`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := tt.route
+			_, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{{Name: "somename", Command: "echo"}},
+				Route:    &route,
+			})
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestGroupMatching(t *testing.T) {
+	firing := internal.Alert{Status: internal.FiringStatus}
+	resolved := internal.Alert{Status: internal.ResolvedStatus}
+
+	tests := []struct {
+		name    string
+		ag      internal.AlertGroup
+		matches bool
+	}{
+		{
+			"everything matches",
+			internal.AlertGroup{
+				Status:      internal.FiringStatus,
+				Receiver:    "executor-db",
+				GroupLabels: map[string]string{"cluster": "prod-1"},
+				ExternalURL: "http://alertmanager.prod:9093",
+				Alerts:      internal.Alerts{firing, firing, firing, resolved},
+			},
+			true,
+		},
+		{
+			"wrong receiver",
+			internal.AlertGroup{
+				Status:      internal.FiringStatus,
+				Receiver:    "executor-web",
+				GroupLabels: map[string]string{"cluster": "prod-1"},
+				ExternalURL: "http://alertmanager.prod:9093",
+				Alerts:      internal.Alerts{firing, firing, firing},
+			},
+			false,
+		},
+		{
+			"missing group label",
+			internal.AlertGroup{
+				Status:      internal.FiringStatus,
+				Receiver:    "executor-db",
+				ExternalURL: "http://alertmanager.prod:9093",
+				Alerts:      internal.Alerts{firing, firing, firing},
+			},
+			false,
+		},
+		{
+			"wrong external url",
+			internal.AlertGroup{
+				Status:      internal.FiringStatus,
+				Receiver:    "executor-db",
+				GroupLabels: map[string]string{"cluster": "prod-1"},
+				ExternalURL: "http://alertmanager.staging:9093",
+				Alerts:      internal.Alerts{firing, firing, firing},
+			},
+			false,
+		},
+		{
+			"not enough firing alerts",
+			internal.AlertGroup{
+				Status:      internal.FiringStatus,
+				Receiver:    "executor-db",
+				GroupLabels: map[string]string{"cluster": "prod-1"},
+				ExternalURL: "http://alertmanager.prod:9093",
+				Alerts:      internal.Alerts{firing, firing, resolved},
+			},
+			false,
+		},
+		{
+			"firing alerts are not counted when resolved",
+			internal.AlertGroup{
+				Status:      internal.ResolvedStatus,
+				Receiver:    "executor-db",
+				GroupLabels: map[string]string{"cluster": "prod-1"},
+				ExternalURL: "http://alertmanager.prod:9093",
+				Alerts:      internal.Alerts{resolved},
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{
+					{
+						Name:            "failover",
+						Command:         "echo",
+						Receiver:        "^executor-db$",
+						GroupLabels:     map[string]string{"cluster": "^prod-"},
+						ExternalURL:     `\.prod:`,
+						MinFiringAlerts: 3,
+					},
+				},
+			})
+			a.NoError(err)
+
+			ex := m.Match(tt.ag)
+			if tt.matches {
+				a.Len(ex, 1)
+			} else {
+				a.Empty(ex)
+			}
+		})
+	}
+}
+
+func TestMinFiringDuration(t *testing.T) {
+	now := time.Now()
+	old := internal.Alert{Status: internal.FiringStatus, StartsAt: now.Add(-time.Hour)}
+	recent := internal.Alert{Status: internal.FiringStatus, StartsAt: now.Add(-time.Minute)}
+	resolved := internal.Alert{Status: internal.ResolvedStatus, StartsAt: now.Add(-time.Minute)}
+
+	tests := []struct {
+		name     string
+		mode     string
+		ag       internal.AlertGroup
+		deferred []bool
+	}{
+		{
+			"group firing long enough",
+			internal.GroupMode,
+			internal.AlertGroup{Status: internal.FiringStatus, Alerts: internal.Alerts{old, resolved}},
+			[]bool{false},
+		},
+		{
+			"group with a recent alert",
+			internal.GroupMode,
+			internal.AlertGroup{Status: internal.FiringStatus, Alerts: internal.Alerts{old, recent}},
+			[]bool{true},
+		},
+		{
+			"resolved group is never deferred",
+			internal.GroupMode,
+			internal.AlertGroup{Status: internal.ResolvedStatus, Alerts: internal.Alerts{resolved}},
+			[]bool{false},
+		},
+		{
+			"each alert on its own",
+			internal.PerAlertMode,
+			internal.AlertGroup{Status: internal.FiringStatus, Alerts: internal.Alerts{old, recent}},
+			[]bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{
+					{
+						Name:             "somename",
+						Command:          "echo",
+						Mode:             tt.mode,
+						MinFiringSeconds: 600,
+					},
+				},
+			})
+			a.NoError(err)
+
+			deferred := make([]bool, 0)
+			for _, ex := range m.Match(tt.ag) {
+				deferred = append(deferred, ex.Deferred(now))
+			}
+			a.Equal(tt.deferred, deferred)
+		})
+	}
+}
+
+func TestTimeIntervals(t *testing.T) {
+	cnf := internal.Configuration{
+		TimeIntervals: []internal.TimeIntervalConfiguration{
+			{
+				Name: "business-hours",
+				TimeIntervals: []internal.TimeIntervalSpecification{
+					{
+						Weekdays: []string{"monday:friday"},
+						Times:    []internal.TimeRangeConfiguration{{StartTime: "09:00", EndTime: "17:00"}},
+					},
+				},
+			},
+			{
+				Name: "lunch",
+				TimeIntervals: []internal.TimeIntervalSpecification{
+					{Times: []internal.TimeRangeConfiguration{{StartTime: "12:00", EndTime: "13:00"}}},
+				},
+			},
+		},
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:                "somename",
+				Command:             "echo",
+				ActiveTimeIntervals: []string{"business-hours"},
+				MuteTimeIntervals:   []string{"lunch"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		now   time.Time
+		muted bool
+	}{
+		{"inside active interval", time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC), false},
+		{"outside active interval", time.Date(2020, 6, 1, 18, 0, 0, 0, time.UTC), true},
+		{"inside mute interval", time.Date(2020, 6, 1, 12, 30, 0, 0, time.UTC), true},
+		{"weekend", time.Date(2020, 6, 6, 10, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			m, err := matcher.New(cnf)
+			a.NoError(err)
+
+			ex := m.Match(internal.AlertGroup{})
+			a.Len(ex, 1)
+			a.Equal(tt.muted, ex[0].Muted(tt.now))
+		})
+	}
+}
+
+func TestInvalidTimeIntervalsFail(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:              "somename",
+				Command:           "echo",
+				MuteTimeIntervals: []string{"missing"},
+			},
+		},
+	})
+	a.EqualError(err, "Unknown time interval missing in matcher somename")
+
+	_, err = matcher.New(internal.Configuration{
+		TimeIntervals: []internal.TimeIntervalConfiguration{
+			{Name: "twice"},
+			{Name: "twice"},
+		},
+	})
+	a.EqualError(err, "Time interval twice is defined more than once")
+}
+
+func TestApproval(t *testing.T) {
+	tests := []struct {
+		name     string
+		cnf      internal.MatcherConfiguration
+		expected time.Duration
+	}{
+		{
+			"not required",
+			internal.MatcherConfiguration{Name: "somename", Command: "echo"},
+			0,
+		},
+		{
+			"default timeout",
+			internal.MatcherConfiguration{Name: "somename", Command: "echo", RequireApproval: true},
+			time.Hour,
+		},
+		{
+			"configured timeout",
+			internal.MatcherConfiguration{Name: "somename", Command: "echo", RequireApproval: true,
+				ApprovalTimeoutSeconds: 600},
+			10 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			m, err := matcher.New(internal.Configuration{
+				Matchers: []internal.MatcherConfiguration{tt.cnf},
+			})
+			a.NoError(err)
+
+			ex := m.Match(internal.AlertGroup{})
+			a.Len(ex, 1)
+			a.Equal(tt.expected, ex[0].Approval())
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := matcher.New(internal.Configuration{
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:      "somename",
+				Command:   "false",
+				Arguments: []string{"--some", "arg"},
+				DryRun:    true,
+			},
+		},
+	})
+	a.NoError(err)
+
+	ex := m.Match(internal.AlertGroup{})
+	a.Len(ex, 1)
+	a.True(ex[0].DryRun())
+
+	output, err := ex[0].Execute()
+	a.NoError(err, "the command is not executed")
+	a.Equal("dry run: false --some arg", output)
+}
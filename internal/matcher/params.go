@@ -0,0 +1,108 @@
+package matcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+var (
+	paramPlaceholder = regexp.MustCompile(`%\{([^}]*)\}`)
+	validParamName   = regexp.MustCompile("^[a-z_][a-z0-9_]*$")
+)
+
+// ParameterError is returned when a parameter can't be extracted from the
+// alert labels, in which case the command is not executed
+type ParameterError struct {
+	Param string
+	Label string
+	Value string
+}
+
+func (e *ParameterError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("parameter %s can't be extracted: label %s is missing or empty", e.Param, e.Label)
+	}
+	return fmt.Sprintf("parameter %s can't be extracted: value %q of label %s is not valid", e.Param, e.Value, e.Label)
+}
+
+type parameter struct {
+	label string
+	regex *regexp.Regexp
+}
+
+func newParameters(name string, pcs []internal.ParameterConfiguration, args ...[]string) (map[string]parameter, error) {
+	params := make(map[string]parameter)
+	for _, pc := range pcs {
+		if !validParamName.MatchString(pc.Name) {
+			return nil, fmt.Errorf("Invalid parameter name %q in matcher %s", pc.Name, name)
+		}
+		if _, ok := params[pc.Name]; ok {
+			return nil, fmt.Errorf("Duplicated parameter %s in matcher %s", pc.Name, name)
+		}
+		if strings.TrimSpace(pc.Label) == "" {
+			return nil, fmt.Errorf("Parameter %s label can't be empty in matcher %s", pc.Name, name)
+		}
+		if !strings.HasPrefix(pc.Regex, "^") || !strings.HasSuffix(pc.Regex, "$") {
+			return nil, fmt.Errorf("Parameter %s regex must be anchored with ^ and $ in matcher %s", pc.Name, name)
+		}
+		if _, err := regexp.Compile(pc.Regex); err != nil {
+			return nil, fmt.Errorf("Failed to compile regex for parameter %s (%s): %s", pc.Name, pc.Regex, err)
+		}
+		// The anchors of the regex don't apply to the whole of an alternation
+		// like ^a|b$, so the value is matched as a whole anyway
+		params[pc.Name] = parameter{
+			label: pc.Label,
+			regex: regexp.MustCompile("^(?:" + pc.Regex + ")$"),
+		}
+	}
+
+	for _, a := range args {
+		for _, arg := range a {
+			for _, placeholder := range paramPlaceholder.FindAllStringSubmatch(arg, -1) {
+				if _, ok := params[placeholder[1]]; !ok {
+					return nil, fmt.Errorf("Argument %q uses undeclared parameter %q in matcher %s",
+						arg, placeholder[1], name)
+				}
+			}
+		}
+	}
+
+	return params, nil
+}
+
+// expandArgs replaces the parameters placeholders in the arguments with the
+// values of the labels, failing if any of the values is not valid
+func (c cmdExecutor) expandArgs() ([]string, error) {
+	if len(c.params) == 0 {
+		return c.args, nil
+	}
+
+	labels := c.alertGroup.CommonLabels
+	if c.alert != nil {
+		labels = c.alert.Labels
+	}
+
+	values := make(map[string]string)
+	for name, param := range c.params {
+		value := labels[param.label]
+		if value == "" || !param.regex.MatchString(value) {
+			return nil, &ParameterError{
+				Param: name,
+				Label: param.label,
+				Value: value,
+			}
+		}
+		values[name] = value
+	}
+
+	args := make([]string, 0, len(c.args))
+	for _, arg := range c.args {
+		args = append(args, paramPlaceholder.ReplaceAllStringFunc(arg, func(placeholder string) string {
+			return values[paramPlaceholder.FindStringSubmatch(placeholder)[1]]
+		}))
+	}
+	return args, nil
+}
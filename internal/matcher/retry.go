@@ -0,0 +1,96 @@
+package matcher
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+)
+
+// RetryPolicy defines how many times and how often a failed command is
+// executed again
+type RetryPolicy struct {
+	MaxAttempts        int
+	InitialBackoff     time.Duration
+	MaxBackoff         time.Duration
+	RetryableExitCodes map[int]bool
+}
+
+// ShouldRetry returns true when the error produced by the given attempt,
+// starting at 1, can be retried and there are attempts left.
+//
+// When no retryable exit codes are configured any error can be retried, but
+// parameters errors, which will never succeed
+func (p RetryPolicy) ShouldRetry(err error, attempt int) bool {
+	if err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if _, ok := err.(*ParameterError); ok {
+		return false
+	}
+	if len(p.RetryableExitCodes) == 0 {
+		return true
+	}
+	return p.RetryableExitCodes[ExitCode(err)]
+}
+
+// Backoff returns how long to wait after the given attempt, starting at 1.
+//
+// It grows exponentially up to the max backoff, and half of it is random to
+// spread the retries
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	half := int64(backoff / 2)
+	if half <= 0 {
+		return backoff
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func newRetryPolicy(name string, rc *internal.RetryConfiguration) (RetryPolicy, error) {
+	if rc == nil {
+		return RetryPolicy{MaxAttempts: 1}, nil
+	}
+
+	if rc.MaxAttempts < 1 {
+		return RetryPolicy{}, fmt.Errorf("Retry max attempts must be at least 1 in matcher %s", name)
+	}
+	if rc.InitialBackoffSeconds < 0 || rc.MaxBackoffSeconds < 0 {
+		return RetryPolicy{}, fmt.Errorf("Retry backoff can't be negative in matcher %s", name)
+	}
+
+	p := RetryPolicy{
+		MaxAttempts:        rc.MaxAttempts,
+		InitialBackoff:     time.Duration(rc.InitialBackoffSeconds) * time.Second,
+		MaxBackoff:         time.Duration(rc.MaxBackoffSeconds) * time.Second,
+		RetryableExitCodes: make(map[int]bool),
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = defaultInitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = defaultMaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		return RetryPolicy{}, fmt.Errorf("Retry max backoff can't be lower than the initial backoff in matcher %s", name)
+	}
+
+	for _, code := range rc.RetryableExitCodes {
+		p.RetryableExitCodes[code] = true
+	}
+
+	return p, nil
+}
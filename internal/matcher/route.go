@@ -0,0 +1,78 @@
+package matcher
+
+import (
+	"fmt"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/labels"
+)
+
+// route is a node of the routing tree
+type route struct {
+	matchers []*labels.Matcher
+	execute  []*oneAlertMatcher
+	cont     bool
+	routes   []*route
+}
+
+func newRoute(rc internal.RouteConfiguration, byName map[string]*oneAlertMatcher) (*route, error) {
+	r := &route{
+		matchers: make([]*labels.Matcher, 0),
+		execute:  make([]*oneAlertMatcher, 0),
+		cont:     rc.Continue,
+		routes:   make([]*route, 0),
+	}
+
+	for _, s := range rc.Matchers {
+		ms, err := labels.ParseMatchers(s)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse matchers in route: %s", err)
+		}
+		r.matchers = append(r.matchers, ms...)
+	}
+
+	for _, name := range rc.Execute {
+		m, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("Route executes unknown matcher %s", name)
+		}
+		r.execute = append(r.execute, m)
+	}
+
+	for _, child := range rc.Routes {
+		c, err := newRoute(child, byName)
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, c)
+	}
+
+	return r, nil
+}
+
+// match returns the routes that apply to the labels the same way the
+// alertmanager does: a child route is only evaluated when the parent matches,
+// evaluation stops at the first matching child unless it sets continue, and a
+// route applies by itself when none of its children do
+func (r *route) match(lbls map[string]string) []*route {
+	for _, m := range r.matchers {
+		if !m.Matches(lbls[m.Name]) {
+			return nil
+		}
+	}
+
+	all := make([]*route, 0)
+	for _, child := range r.routes {
+		matches := child.match(lbls)
+		all = append(all, matches...)
+
+		if len(matches) > 0 && !child.cont {
+			break
+		}
+	}
+
+	if len(all) == 0 {
+		all = append(all, r)
+	}
+	return all
+}
@@ -0,0 +1,127 @@
+package messenger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Action ids of the approval buttons
+const (
+	ApproveAction = "approve"
+	RejectAction  = "reject"
+)
+
+// slackRequestMaxAge is how old a signed request can be before it is
+// considered a replay
+const slackRequestMaxAge = 5 * time.Minute
+
+// SlackInteraction is a click on one of the approval buttons
+type SlackInteraction struct {
+	Action      string
+	JobID       string
+	User        string
+	ResponseURL string
+}
+
+// VerifySlackRequest checks that the request was signed by slack with the
+// signing secret of the app, and that it was not sent too long ago
+func VerifySlackRequest(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid request timestamp %q", timestamp)
+	}
+
+	age := now.Sub(time.Unix(ts, 0))
+	if age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return fmt.Errorf("request timestamp %s is too far from the current time", timestamp)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("invalid request signature")
+	}
+	return nil
+}
+
+// ParseSlackInteraction reads the form encoded payload of a block actions
+// interaction
+func ParseSlackInteraction(body []byte) (SlackInteraction, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return SlackInteraction{}, fmt.Errorf("failed to parse form: %s", err)
+	}
+
+	payload := struct {
+		Type string `json:"type"`
+		User struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+		ResponseURL string `json:"response_url"`
+		Actions     []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}{}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		return SlackInteraction{}, fmt.Errorf("failed to decode payload: %s", err)
+	}
+
+	if payload.Type != "block_actions" || len(payload.Actions) != 1 {
+		return SlackInteraction{}, fmt.Errorf("unsupported interaction %s with %d actions",
+			payload.Type, len(payload.Actions))
+	}
+
+	action := payload.Actions[0]
+	if action.ActionID != ApproveAction && action.ActionID != RejectAction {
+		return SlackInteraction{}, fmt.Errorf("unsupported action %s", action.ActionID)
+	}
+
+	user := payload.User.Username
+	if user == "" {
+		user = payload.User.ID
+	}
+
+	return SlackInteraction{
+		Action:      action.ActionID,
+		JobID:       action.Value,
+		User:        user,
+		ResponseURL: payload.ResponseURL,
+	}, nil
+}
+
+// RespondSlackInteraction responds to the user that clicked the button with the
+// given text, replacing the message that contained the buttons so they can't
+// be clicked again if asked to
+func RespondSlackInteraction(responseURL, text string, replace bool) error {
+	b, err := json.Marshal(struct {
+		ReplaceOriginal bool   `json:"replace_original"`
+		Text            string `json:"text"`
+	}{replace, text})
+	if err != nil {
+		return fmt.Errorf("failed to encode json with the response %s: %s", text, err)
+	}
+
+	resp, err := http.Post(responseURL, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return fmt.Errorf("Failed to POST to slack: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to POST to slack: %s", resp.Status)
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
 
 	"github.com/sirupsen/logrus"
 
@@ -25,6 +26,11 @@ func Slack(url string) internal.Messenger {
 	}
 }
 
+// GoString hides the webhook url, which is a secret, from debug dumps
+func (s slackMessenger) GoString() string {
+	return fmt.Sprintf("messenger.Slack(%q)", secrets.Mask)
+}
+
 func (s slackMessenger) Send(event internal.Event, message string) error {
 	if strings.TrimSpace(message) == "" {
 		metrics.SlackNotificationsTotal.WithLabelValues(string(event), "empty-message").Inc()
@@ -32,14 +38,63 @@ func (s slackMessenger) Send(event internal.Event, message string) error {
 		return nil
 	}
 
-	b, err := json.Marshal(slackPayload{
+	return s.post(event, message, slackPayload{
 		[]slackAttachment{
 			slackAttachment{
-				event.Color(),
-				message,
+				Color: event.Color(),
+				Text:  message,
 			},
 		},
 	})
+}
+
+// SendApproval sends the message with buttons to approve or reject the job,
+// which requires the slack app to have interactivity enabled
+func (s slackMessenger) SendApproval(message, jobID string) error {
+	event := internal.ApprovalEvent
+	if strings.TrimSpace(message) == "" {
+		metrics.SlackNotificationsTotal.WithLabelValues(string(event), "empty-message").Inc()
+		logrus.Debugf("received empty message to send, ignoring")
+		return nil
+	}
+
+	return s.post(event, message, slackPayload{
+		[]slackAttachment{
+			slackAttachment{
+				Color: event.Color(),
+				Blocks: []slackBlock{
+					{
+						Type: "section",
+						Text: &slackText{Type: "mrkdwn", Text: message},
+					},
+					{
+						Type:    "actions",
+						BlockID: "approval",
+						Elements: []slackButton{
+							{
+								Type:     "button",
+								Text:     slackText{Type: "plain_text", Text: "Approve"},
+								Style:    "primary",
+								ActionID: ApproveAction,
+								Value:    jobID,
+							},
+							{
+								Type:     "button",
+								Text:     slackText{Type: "plain_text", Text: "Reject"},
+								Style:    "danger",
+								ActionID: RejectAction,
+								Value:    jobID,
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func (s slackMessenger) post(event internal.Event, message string, payload slackPayload) error {
+	b, err := json.Marshal(payload)
 	if err != nil {
 		metrics.SlackNotificationsTotal.WithLabelValues(string(event), "encoding-error").Inc()
 		return fmt.Errorf("failed to encode json with the message %s: %s", message, err)
@@ -50,6 +105,7 @@ func (s slackMessenger) Send(event internal.Event, message string) error {
 		metrics.SlackNotificationsTotal.WithLabelValues(string(event), "error").Inc()
 		return fmt.Errorf("Failed to POST to slack: %s", err)
 	}
+	resp.Body.Close()
 
 	logrus.WithField("statusCode", resp.StatusCode).
 		WithField("message", message).
@@ -64,6 +120,27 @@ type slackPayload struct {
 }
 
 type slackAttachment struct {
-	Color string `json:"color"`
-	Text  string `json:"text"`
+	Color  string       `json:"color"`
+	Text   string       `json:"text,omitempty"`
+	Blocks []slackBlock `json:"blocks,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string        `json:"type"`
+	BlockID  string        `json:"block_id,omitempty"`
+	Text     *slackText    `json:"text,omitempty"`
+	Elements []slackButton `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackButton struct {
+	Type     string    `json:"type"`
+	Text     slackText `json:"text"`
+	Style    string    `json:"style,omitempty"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
 }
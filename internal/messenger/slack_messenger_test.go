@@ -0,0 +1,116 @@
+package messenger_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/messenger"
+)
+
+func fakeSlack() (*httptest.Server, chan string) {
+	bodies := make(chan string, 10)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+	})), bodies
+}
+
+func TestSlackMessages(t *testing.T) {
+	a := assert.New(t)
+	slack, bodies := fakeSlack()
+	defer slack.Close()
+
+	m := messenger.Slack(slack.URL)
+	a.NoError(m.Send(internal.FailureEvent, "it failed"))
+	a.JSONEq(`{"attachments": [{"color": "danger", "text": "it failed"}]}`, <-bodies)
+
+	am, ok := m.(internal.ApprovalMessenger)
+	a.True(ok, "slack messenger can send approvals")
+	a.NoError(am.SendApproval("approve me", "42"))
+	a.JSONEq(`{"attachments": [{"color": "warning", "blocks": [
+		{"type": "section", "text": {"type": "mrkdwn", "text": "approve me"}},
+		{"type": "actions", "block_id": "approval", "elements": [
+			{"type": "button", "text": {"type": "plain_text", "text": "Approve"},
+			 "style": "primary", "action_id": "approve", "value": "42"},
+			{"type": "button", "text": {"type": "plain_text", "text": "Reject"},
+			 "style": "danger", "action_id": "reject", "value": "42"}
+		]}
+	]}]}`, <-bodies)
+
+	a.NoError(messenger.RespondSlackInteraction(slack.URL, "approved", true))
+	a.JSONEq(`{"replace_original": true, "text": "approved"}`, <-bodies)
+}
+
+func TestVerifySlackRequest(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte("payload=%7B%7D")
+
+	sign := func(secret, timestamp string) http.Header {
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+		h := http.Header{}
+		h.Set("X-Slack-Request-Timestamp", timestamp)
+		h.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		return h
+	}
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected string
+	}{
+		{"valid", sign("secret", "1600000000"), ""},
+		{"wrong secret", sign("other", "1600000000"), "invalid request signature"},
+		{"too old", sign("secret", "1599999000"), "request timestamp 1599999000 is too far from the current time"},
+		{"no timestamp", http.Header{}, `invalid request timestamp ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := messenger.VerifySlackRequest("secret", tt.header, body, now)
+			if tt.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSlackInteraction(t *testing.T) {
+	a := assert.New(t)
+
+	body := url.Values{"payload": []string{`{
+		"type": "block_actions",
+		"user": {"id": "U123", "username": "alice"},
+		"response_url": "https://hooks.slack.com/actions/1",
+		"actions": [{"action_id": "reject", "value": "42"}]
+	}`}}.Encode()
+
+	interaction, err := messenger.ParseSlackInteraction([]byte(body))
+	a.NoError(err)
+	a.Equal(messenger.SlackInteraction{
+		Action:      messenger.RejectAction,
+		JobID:       "42",
+		User:        "alice",
+		ResponseURL: "https://hooks.slack.com/actions/1",
+	}, interaction)
+
+	body = url.Values{"payload": []string{`{
+		"type": "block_actions",
+		"actions": [{"action_id": "delete", "value": "42"}]
+	}`}}.Encode()
+	_, err = messenger.ParseSlackInteraction([]byte(body))
+	a.EqualError(err, "unsupported action delete")
+}
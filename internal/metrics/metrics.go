@@ -35,6 +35,13 @@ var (
 			Help:      "wether or not the last configuration was successfully reloaded",
 		},
 	)
+	ConfigHash = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "configuration_hash_info",
+			Help:      "hash of the active configuration, as a label",
+		}, []string{"hash"},
+	)
 	SlackUp = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "slack_up",
@@ -62,6 +69,12 @@ var (
 		Name:      "invalid_total",
 		Help:      "total number of invalid webhooks received",
 	})
+	WebhooksRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhooks",
+		Name:      "rejected_total",
+		Help:      "total number of valid webhooks rejected because they could not be queued",
+	}, []string{"reason"})
 
 	AlertsMatchedToCommand = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -79,6 +92,14 @@ var (
 			Help:      "total number of alerts that did not match to a command",
 		})
 
+	AlertsSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "alert",
+			Name:      "skipped_total",
+			Help:      "total number of matched alerts that were not executed",
+		}, []string{"matcher", "reason"})
+
 	CommandsExecuted = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
@@ -87,6 +108,30 @@ var (
 			Help:      "total number of command executions",
 		}, []string{"matcher", "successful"})
 
+	CommandsRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "command",
+			Name:      "rejected_total",
+			Help:      "total number of command executions rejected because of invalid parameters",
+		}, []string{"matcher"})
+
+	CommandsSimulated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "command",
+			Name:      "simulated_total",
+			Help:      "total number of commands that were not executed because of dry run",
+		}, []string{"matcher"})
+
+	CommandRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "command",
+			Name:      "retries_total",
+			Help:      "total number of failed command executions that were retried",
+		}, []string{"matcher"})
+
 	CommandExecutionSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:  namespace,
 		Subsystem:  "command",
@@ -94,6 +139,62 @@ var (
 		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
 		Help:       "command execution seconds summary",
 	}, []string{"matcher", "successful"})
+
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "depth",
+		Help:      "number of matches waiting in the queue to be executed",
+	})
+	QueueCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "capacity",
+		Help:      "maximum number of matches that can wait in the queue",
+	})
+	JobsRecovered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "recovered_jobs_total",
+		Help:      "total number of jobs recovered from the persisted queue on startup",
+	}, []string{"outcome"})
+	WorkersTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "workers",
+		Name:      "total",
+		Help:      "number of workers executing matches",
+	})
+	WorkersBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "workers",
+		Name:      "busy",
+		Help:      "number of workers currently executing a match",
+	})
+	WorkerPanicsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "workers",
+		Name:      "panics_total",
+		Help:      "total number of panics recovered while executing a match",
+	})
+	ApprovalsPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "approvals",
+		Name:      "pending",
+		Help:      "number of matches waiting to be approved",
+	})
+	ApprovalsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "approvals",
+		Name:      "total",
+		Help:      "total number of matches that required approval by outcome",
+	}, []string{"matcher", "outcome"})
+
+	Paused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "paused",
+		Help:      "whether the executions of a matcher are paused, * for all of them",
+	}, []string{"matcher"})
+
 	SlackNotificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: "slack",
@@ -110,6 +211,7 @@ func init() {
 		buildInfo,
 		LastConfigReloadTime,
 		LastConfigReloadSuccessful,
+		ConfigHash,
 		SlackUp,
 	)
 
@@ -117,10 +219,24 @@ func init() {
 		AlertsReceivedTotal,
 		AlertsMissed,
 		AlertsMatchedToCommand,
+		AlertsSkipped,
 		CommandsExecuted,
+		CommandsRejected,
+		CommandsSimulated,
+		CommandRetriesTotal,
 		CommandExecutionSeconds,
 		InvalidWebhooksTotal,
 		WebhooksReceivedTotal,
+		WebhooksRejectedTotal,
+		QueueDepth,
+		QueueCapacity,
+		JobsRecovered,
+		WorkersTotal,
+		WorkersBusy,
+		WorkerPanicsTotal,
+		ApprovalsPending,
+		ApprovalsTotal,
+		Paused,
 	)
 
 }
@@ -17,10 +17,40 @@ func TestMetricsAreRegistered(t *testing.T) {
 		"alerts missed")
 	a.True(prometheus.DefaultRegisterer.Unregister(metrics.AlertsMatchedToCommand),
 		"alerts matched to a command")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.AlertsSkipped),
+		"alerts skipped")
 	a.True(prometheus.DefaultRegisterer.Unregister(metrics.CommandsExecuted),
 		"commands executed")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.CommandsRejected),
+		"commands rejected")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.CommandsSimulated),
+		"commands simulated")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.CommandRetriesTotal),
+		"command retries total")
 	a.True(prometheus.DefaultRegisterer.Unregister(metrics.InvalidWebhooksTotal),
 		"invalid webhooks total")
 	a.True(prometheus.DefaultRegisterer.Unregister(metrics.WebhooksReceivedTotal),
 		"webhooks received total")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.WebhooksRejectedTotal),
+		"webhooks rejected total")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.QueueDepth),
+		"queue depth")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.QueueCapacity),
+		"queue capacity")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.JobsRecovered),
+		"jobs recovered")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.WorkersTotal),
+		"workers total")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.WorkersBusy),
+		"workers busy")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.WorkerPanicsTotal),
+		"worker panics total")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.ApprovalsPending),
+		"approvals pending")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.ApprovalsTotal),
+		"approvals total")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.Paused),
+		"paused")
+	a.True(prometheus.DefaultRegisterer.Unregister(metrics.ConfigHash),
+		"configuration hash")
 }
@@ -0,0 +1,260 @@
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+// Mask is what the secrets are replaced with
+const Mask = "<redacted>"
+
+// minLength is the length a value needs to be redacted, shorter values would
+// redact unrelated text all over the place
+const minLength = 6
+
+var (
+	reference = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+	envName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Expander replaces the ${NAME} references with the value of the environment
+// variable, and the ${file:/path} references with the content of the file
+// without the trailing newline. $${ is kept as a literal ${.
+//
+// When MinLength is set, references to values shorter than it fail to expand,
+// except for empty values
+type Expander struct {
+	LookupEnv func(string) (string, bool)
+	ReadFile  func(string) ([]byte, error)
+	MinLength int
+
+	values []string
+}
+
+// NewExpander returns an expander that reads the environment and the file
+// system
+func NewExpander() *Expander {
+	return &Expander{
+		LookupEnv: os.LookupEnv,
+		ReadFile:  ioutil.ReadFile,
+	}
+}
+
+// Expand replaces all the references in the string
+func (e *Expander) Expand(s string) (string, error) {
+	var err error
+	expanded := reference.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		if ref == "$${" {
+			return "${"
+		}
+
+		value, lookupErr := e.lookup(ref[2 : len(ref)-1])
+		if lookupErr != nil {
+			err = lookupErr
+			return ref
+		}
+		if value != "" && len(value) < e.MinLength {
+			err = fmt.Errorf("%s is shorter than %d characters", ref, e.MinLength)
+			return ref
+		}
+		e.values = append(e.values, value)
+		return value
+	})
+	return expanded, err
+}
+
+// Values returns all the values that have been expanded
+func (e *Expander) Values() []string {
+	return e.values
+}
+
+func (e *Expander) lookup(name string) (string, error) {
+	if strings.HasPrefix(name, "file:") {
+		filename := strings.TrimPrefix(name, "file:")
+		b, err := e.ReadFile(filename)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %s", filename, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	if !envName.MatchString(name) {
+		return "", fmt.Errorf("invalid reference ${%s}", name)
+	}
+	value, ok := e.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// ExpandConfiguration expands the references in the commands, arguments,
+// environment and templates of the matchers, and in the default template.
+//
+// Returns the values expanded in the commands, arguments and environment,
+// which are considered secrets, and fails when any of them is too short to be
+// redacted. The ones expanded in the templates are meant to be announced, so
+// they are not
+func ExpandConfiguration(cnf *internal.Configuration) ([]string, error) {
+	e := NewExpander()
+	e.MinLength = minLength
+	templates := &Expander{LookupEnv: e.LookupEnv, ReadFile: e.ReadFile}
+
+	if cnf.DefaultTemplate != nil {
+		t, err := expandTemplate(templates, *cnf.DefaultTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand the default template: %s", err)
+		}
+		cnf.DefaultTemplate = &t
+	}
+
+	for i := range cnf.Matchers {
+		if err := expandMatcher(e, templates, &cnf.Matchers[i]); err != nil {
+			m := cnf.Matchers[i]
+			if m.File != "" {
+				return nil, fmt.Errorf("%s: failed to expand matcher %s: %s", m.File, m.Name, err)
+			}
+			return nil, fmt.Errorf("failed to expand matcher %s: %s", m.Name, err)
+		}
+	}
+	return e.Values(), nil
+}
+
+func expandMatcher(e, templates *Expander, m *internal.MatcherConfiguration) error {
+	var err error
+	if m.Command, err = e.Expand(m.Command); err != nil {
+		return fmt.Errorf("command: %s", err)
+	}
+	if m.Arguments, err = expandAll(e, m.Arguments); err != nil {
+		return fmt.Errorf("args: %s", err)
+	}
+	if m.ResolvedCommand, err = e.Expand(m.ResolvedCommand); err != nil {
+		return fmt.Errorf("resolved_command: %s", err)
+	}
+	if m.ResolvedArguments, err = expandAll(e, m.ResolvedArguments); err != nil {
+		return fmt.Errorf("resolved_args: %s", err)
+	}
+
+	if m.Env != nil {
+		env := make(map[string]string, len(m.Env))
+		for name, value := range m.Env {
+			if env[name], err = e.Expand(value); err != nil {
+				return fmt.Errorf("env %s: %s", name, err)
+			}
+		}
+		m.Env = env
+	}
+
+	if m.Template != nil {
+		t, err := expandTemplate(templates, *m.Template)
+		if err != nil {
+			return fmt.Errorf("template: %s", err)
+		}
+		m.Template = &t
+	}
+	return nil
+}
+
+func expandAll(e *Expander, values []string) ([]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	expanded := make([]string, len(values))
+	for i, v := range values {
+		var err error
+		if expanded[i], err = e.Expand(v); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+func expandTemplate(e *Expander, t internal.MessageTemplate) (internal.MessageTemplate, error) {
+	for _, message := range []*string{&t.OnMatch, &t.OnResolved, &t.OnSuccess,
+		&t.OnFailure, &t.OnSkipped, &t.OnRetry, &t.OnApproval} {
+		var err error
+		if *message, err = e.Expand(*message); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// registry holds the secrets to redact by the name of who set them
+var registry = struct {
+	sync.RWMutex
+	sets    map[string][]string
+	secrets []string
+}{sets: make(map[string][]string)}
+
+// Set replaces the secrets registered with the name
+func Set(name string, values ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.sets[name] = values
+
+	all := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, set := range registry.sets {
+		for _, v := range set {
+			if len(v) < minLength || seen[v] {
+				continue
+			}
+			seen[v] = true
+			all = append(all, v)
+
+			// Also the way it looks when it is quoted, as in %#v or json
+			if q := strconv.Quote(v); q[1:len(q)-1] != v && !seen[q[1:len(q)-1]] {
+				seen[q[1:len(q)-1]] = true
+				all = append(all, q[1:len(q)-1])
+			}
+		}
+	}
+
+	// Longer secrets first, in case one contains another
+	sort.Slice(all, func(i, j int) bool {
+		return len(all[i]) > len(all[j])
+	})
+	registry.secrets = all
+}
+
+// Redact replaces all the registered secrets in the string with the mask
+func Redact(s string) string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, secret := range registry.secrets {
+		s = strings.Replace(s, secret, Mask, -1)
+	}
+	return s
+}
+
+// Formatter redacts the registered secrets from the log entries formatted by
+// the wrapped formatter
+type Formatter struct {
+	log.Formatter
+}
+
+// Format formats the entry and redacts it
+func (f Formatter) Format(entry *log.Entry) ([]byte, error) {
+	b, err := f.Formatter.Format(entry)
+	if err != nil {
+		return b, err
+	}
+	return []byte(Redact(string(b))), nil
+}
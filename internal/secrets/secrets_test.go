@@ -0,0 +1,136 @@
+package secrets_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
+)
+
+func newExpander() *secrets.Expander {
+	return &secrets.Expander{
+		LookupEnv: func(name string) (string, bool) {
+			value, ok := map[string]string{
+				"TOKEN": "s3cr3t-token",
+				"EMPTY": "",
+				"SHORT": "us",
+			}[name]
+			return value, ok
+		},
+		ReadFile: func(filename string) ([]byte, error) {
+			if filename == "/run/secrets/password" {
+				return []byte("hunter2-password\n"), nil
+			}
+			return nil, fmt.Errorf("open %s: no such file or directory", filename)
+		},
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected string
+		err      string
+	}{
+		{"nothing to expand", "echo $HOME", "echo $HOME", ""},
+		{"environment variable", "--token=${TOKEN}", "--token=s3cr3t-token", ""},
+		{"empty environment variable", "x${EMPTY}x", "xx", ""},
+		{"file", "${file:/run/secrets/password}", "hunter2-password", ""},
+		{"escaped", "echo $${TOKEN} ${TOKEN}", "echo ${TOKEN} s3cr3t-token", ""},
+		{"unset environment variable", "${MISSING}", "", "environment variable MISSING is not set"},
+		{"missing file", "${file:/missing}", "",
+			"failed to read secret file /missing: open /missing: no such file or directory"},
+		{"invalid reference", "${not valid}", "", "invalid reference ${not valid}"},
+		{"short value", "--user=${SHORT}", "", "${SHORT} is shorter than 6 characters"},
+		{"empty value", "x${EMPTY}x", "xx", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			e := newExpander()
+			e.MinLength = 6
+			expanded, err := e.Expand(tt.in)
+			if tt.err != "" {
+				a.EqualError(err, tt.err)
+				return
+			}
+			a.NoError(err)
+			a.Equal(tt.expected, expanded)
+		})
+	}
+}
+
+func TestExpandConfiguration(t *testing.T) {
+	a := assert.New(t)
+
+	os.Setenv("CAE_TEST_TOKEN", "s3cr3t-token")
+	os.Setenv("CAE_TEST_URL", "https://deploy.example.com")
+	defer os.Unsetenv("CAE_TEST_TOKEN")
+	defer os.Unsetenv("CAE_TEST_URL")
+
+	cnf := internal.Configuration{
+		DefaultTemplate: &internal.MessageTemplate{OnMatch: "see ${CAE_TEST_URL}"},
+		Matchers: []internal.MatcherConfiguration{
+			{
+				Name:      "deploy",
+				Command:   "deploy.sh",
+				Arguments: []string{"--token", "${CAE_TEST_TOKEN}"},
+				Env:       map[string]string{"TOKEN": "${CAE_TEST_TOKEN}"},
+			},
+		},
+	}
+
+	values, err := secrets.ExpandConfiguration(&cnf)
+	a.NoError(err)
+	a.Equal([]string{"s3cr3t-token", "s3cr3t-token"}, values)
+	a.Equal("see https://deploy.example.com", cnf.DefaultTemplate.OnMatch)
+	a.Equal([]string{"--token", "s3cr3t-token"}, cnf.Matchers[0].Arguments)
+	a.Equal(map[string]string{"TOKEN": "s3cr3t-token"}, cnf.Matchers[0].Env)
+
+	os.Setenv("CAE_TEST_SHORT", "us")
+	defer os.Unsetenv("CAE_TEST_SHORT")
+	cnf.Matchers[0].Env = map[string]string{"REGION": "${CAE_TEST_SHORT}"}
+	_, err = secrets.ExpandConfiguration(&cnf)
+	a.EqualError(err, "failed to expand matcher deploy: env REGION: ${CAE_TEST_SHORT} is shorter than 6 characters")
+
+	cnf.Matchers[0].Env = nil
+	cnf.DefaultTemplate = &internal.MessageTemplate{OnMatch: "in ${CAE_TEST_SHORT}"}
+	_, err = secrets.ExpandConfiguration(&cnf)
+	a.NoError(err)
+	a.Equal("in us", cnf.DefaultTemplate.OnMatch)
+
+	cnf.Matchers[0].Command = "${CAE_TEST_MISSING}"
+	cnf.Matchers[0].File = "teams/deploy.yml"
+	_, err = secrets.ExpandConfiguration(&cnf)
+	a.EqualError(err, "teams/deploy.yml: failed to expand matcher deploy: command: "+
+		"environment variable CAE_TEST_MISSING is not set")
+}
+
+func TestRedact(t *testing.T) {
+	a := assert.New(t)
+
+	secrets.Set("test", "s3cr3t-token", `quoted"secret`, "short")
+	defer secrets.Set("test")
+
+	a.Equal("--token <redacted>", secrets.Redact("--token s3cr3t-token"))
+	a.Equal(`"<redacted>"`, secrets.Redact(fmt.Sprintf("%q", `quoted"secret`)))
+	a.Equal("short values are kept", secrets.Redact("short values are kept"))
+
+	b := bytes.NewBufferString("")
+	logger := log.New()
+	logger.Out = b
+	logger.Formatter = secrets.Formatter{Formatter: &log.TextFormatter{DisableTimestamp: true}}
+	logger.WithField("args", []string{"--token", "s3cr3t-token"}).Infof("executing with s3cr3t-token")
+	a.Equal("level=info msg=\"executing with <redacted>\" args=\"[--token <redacted>]\"\n", b.String())
+
+	secrets.Set("test")
+	a.Equal("--token s3cr3t-token", secrets.Redact("--token s3cr3t-token"))
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
+)
+
+// approval is a match that waits for someone to approve or reject it before
+// being queued
+type approval struct {
+	id        string
+	match     matchPayload
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+var (
+	errNotWaitingForApproval = errors.New("job is not waiting for approval")
+	errPaused                = errors.New("matcher is paused")
+)
+
+type approvalResponse struct {
+	ID      string `json:"id"`
+	Matcher string `json:"matcher"`
+	Outcome string `json:"outcome"`
+}
+
+// requestApproval holds the match until it is approved, rejected or it
+// expires, and announces that it is waiting for approval
+func (s *Server) requestApproval(m matchPayload) {
+	now := time.Now()
+	expiresAt := now.Add(m.match.Approval())
+
+	var id string
+	if s.store != nil {
+		job, err := s.store.AddJob(store.Job{
+			Matcher:    m.match.Name(),
+			AlertGroup: m.alertGroup,
+			Alert:      m.match.Alert(),
+			State:      store.AwaitingApprovalState,
+			QueuedAt:   now,
+			ExpiresAt:  &expiresAt,
+		})
+		if err != nil {
+			s.skip(m.alertGroup, m.match, "store_error", err.Error())
+			return
+		}
+		m.job = &job
+		id = job.ID
+	} else {
+		var err error
+		if id, err = store.NewID(); err != nil {
+			s.skip(m.alertGroup, m.match, "store_error", err.Error())
+			return
+		}
+	}
+
+	s.holdForApproval(id, m, expiresAt)
+
+	s.m.Lock()
+	templater := s.templater.WithTemplate(m.match.Template())
+	s.m.Unlock()
+
+	logger := log.WithField("payload", m.alertGroup).
+		WithField("match", m.match).
+		WithField("job", id)
+	logger.Infof("execution of matcher %s is waiting for approval", m.match.Name())
+
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+
+		s.announce(templater, internal.ApprovalEvent, TemplatePayload{
+			AlertGroup: m.alertGroup,
+			Alert:      m.match.Alert(),
+			Match:      m.match,
+			JobID:      id,
+			ApproveURL: s.jobURL(id, "approve"),
+			RejectURL:  s.jobURL(id, "reject"),
+		}, logger)
+	}()
+}
+
+// holdForApproval keeps the match until it expires
+func (s *Server) holdForApproval(id string, m matchPayload, expiresAt time.Time) {
+	s.a.Lock()
+	defer s.a.Unlock()
+
+	s.approvals[id] = &approval{
+		id:        id,
+		match:     m,
+		expiresAt: expiresAt,
+		timer: time.AfterFunc(time.Until(expiresAt), func() {
+			s.expireApproval(id)
+		}),
+	}
+	metrics.ApprovalsPending.Inc()
+}
+
+// release stops holding the match, it must be called with the approvals lock
+func (s *Server) release(a *approval) {
+	a.timer.Stop()
+	delete(s.approvals, a.id)
+	metrics.ApprovalsPending.Dec()
+}
+
+// drop removes the job that was waiting for approval and announces it was
+// skipped for the given reason
+func (s *Server) drop(a *approval, reason, details string) {
+	metrics.ApprovalsTotal.WithLabelValues(a.match.match.Name(), reason).Inc()
+
+	logger := log.WithField("job", a.id).WithField("matcher", a.match.match.Name())
+	s.finishJob(a.match, logger)
+	s.skip(a.match.alertGroup, a.match.match, reason, details)
+}
+
+func (s *Server) expireApproval(id string) {
+	s.a.Lock()
+	defer s.a.Unlock()
+
+	a, ok := s.approvals[id]
+	if !ok {
+		return
+	}
+	s.release(a)
+	s.drop(a, "approval_timeout", "")
+}
+
+func (s *Server) stopApprovals() {
+	s.a.Lock()
+	defer s.a.Unlock()
+
+	for _, a := range s.approvals {
+		a.timer.Stop()
+	}
+}
+
+func (s *Server) jobURL(id, action string) string {
+	if s.externalURL == "" || s.apiToken == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/v1/jobs/%s/%s", s.externalURL, id, action)
+}
+
+// approve queues the job waiting for approval, it keeps waiting if it can't
+// be queued
+func (s *Server) approve(id, by string) (string, error) {
+	s.a.Lock()
+	defer s.a.Unlock()
+
+	a, ok := s.approvals[id]
+	if !ok {
+		return "", errNotWaitingForApproval
+	}
+
+	name := a.match.match.Name()
+	if _, paused := s.paused(name); paused {
+		return name, errPaused
+	}
+
+	if err := s.enqueue(a.match); err != nil {
+		return name, err
+	}
+
+	s.release(a)
+	metrics.ApprovalsTotal.WithLabelValues(name, "approved").Inc()
+	log.WithField("job", id).
+		WithField("by", by).
+		Infof("execution of matcher %s was approved", name)
+	return name, nil
+}
+
+// reject drops the job waiting for approval
+func (s *Server) reject(id, by string) (string, error) {
+	s.a.Lock()
+	defer s.a.Unlock()
+
+	a, ok := s.approvals[id]
+	if !ok {
+		return "", errNotWaitingForApproval
+	}
+
+	details := ""
+	if by != "" {
+		details = "by " + by
+	}
+
+	name := a.match.match.Name()
+	s.release(a)
+	s.drop(a, "rejected", details)
+	log.WithField("job", id).
+		WithField("by", by).
+		Infof("execution of matcher %s was rejected", name)
+	return name, nil
+}
+
+func (s *Server) approveJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	name, err := s.approve(id, "")
+	switch err {
+	case nil:
+		writeJSON(w, approvalResponse{ID: id, Matcher: name, Outcome: "approved"})
+	case errNotWaitingForApproval:
+		httpError(w, fmt.Sprintf("Job %s is not waiting for approval", id), http.StatusNotFound)
+	case errPaused:
+		httpError(w, fmt.Sprintf("Executions of %s are paused", name), http.StatusConflict)
+	case errQueueFull:
+		if s.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.retryAfter.Seconds())))
+		}
+		fallthrough
+	default:
+		httpError(w, fmt.Sprintf("Failed to queue job %s: %s", id, err), http.StatusServiceUnavailable)
+	}
+}
+
+func (s *Server) rejectJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	name, err := s.reject(id, "")
+	if err != nil {
+		httpError(w, fmt.Sprintf("Job %s is not waiting for approval", id), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, approvalResponse{ID: id, Matcher: name, Outcome: "rejected"})
+}
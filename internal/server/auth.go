@@ -0,0 +1,25 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// authenticated only lets through the requests that carry the API token as a
+// bearer token
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		if token == authorization || subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) != 1 {
+			log.Warnf("Rejecting unauthenticated request to %s", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, "Invalid or missing API token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
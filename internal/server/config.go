@@ -3,30 +3,190 @@ package server
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/configcheck"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
 )
 
-// Load loads the configuration from the provided file
+// Load loads the configuration from the provided file, registering the
+// secrets it expands to be redacted
 func Load(filename string) (internal.Configuration, error) {
-	c := internal.Configuration{}
+	c, err := load(filename)
+	if err != nil {
+		metrics.LastConfigReloadSuccessful.Set(0)
+		return c.Configuration, err
+	}
+	secrets.Set(configurationSecrets, c.secrets...)
+
+	metrics.LastConfigReloadSuccessful.Set(1)
+	metrics.LastConfigReloadTime.SetToCurrentTime()
+	return c.Configuration, nil
+}
+
+// Check loads the configuration from the provided file and returns all the
+// problems that would only show once alerts are matched
+func Check(filename string) ([]configcheck.Problem, error) {
+	c, err := load(filename)
+	if err != nil {
+		return nil, err
+	}
+	secrets.Set(configurationSecrets, c.secrets...)
+
+	return configcheck.Check(c.Configuration, c.sources), nil
+}
+
+// configurationSecrets is the name the secrets of the configuration are
+// registered with
+const configurationSecrets = "configuration"
+
+// loadedConfiguration is the configuration along with what it was loaded from
+type loadedConfiguration struct {
+	internal.Configuration
+
+	// sources are the content of every file read, by file name
+	sources map[string][]byte
+
+	// secrets are the values expanded in the commands, arguments and
+	// environment of the matchers
+	secrets []string
+}
+
+// load loads the configuration from the file, or from all the yaml files in
+// the directory in name order, and expands the references to the environment
+// and to secret files
+func load(path string) (loadedConfiguration, error) {
+	l := loader{sources: make(map[string][]byte)}
+
+	var err error
+	if info, statErr := os.Stat(path); statErr == nil && info.IsDir() {
+		err = l.loadDir(path)
+	} else {
+		err = l.loadFile(filepath.Clean(path))
+	}
+	if err != nil {
+		return loadedConfiguration{}, err
+	}
+
+	values, err := secrets.ExpandConfiguration(&l.cnf)
+	if err != nil {
+		return loadedConfiguration{}, err
+	}
+	return loadedConfiguration{
+		Configuration: l.cnf,
+		sources:       l.sources,
+		secrets:       values,
+	}, nil
+}
+
+// loader merges the configuration files, where the matchers and time
+// intervals of each file are added after the ones of the previous files and
+// before the ones of the files it includes
+type loader struct {
+	cnf     internal.Configuration
+	sources map[string][]byte
+
+	defaultTemplateFile string
+	routeFile           string
+}
+
+func (l *loader) loadDir(dir string) error {
+	files := make([]string, 0)
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return fmt.Errorf("failed to list configuration files in %s: %s", dir, err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no configuration files found in %s", dir)
+	}
+
+	sort.Strings(files)
+	for _, f := range files {
+		if err := l.loadFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *loader) loadFile(filename string) error {
+	if _, ok := l.sources[filename]; ok {
+		return fmt.Errorf("configuration file %s is included more than once", filename)
+	}
 
 	in, err := ioutil.ReadFile(filename)
 	if err != nil {
-		metrics.LastConfigReloadSuccessful.Set(0)
-		return c, fmt.Errorf("failed to read configuration file %s: %s", filename, err)
+		return fmt.Errorf("failed to read configuration file %s: %s", filename, err)
 	}
 
+	c := internal.Configuration{}
 	err = yaml.UnmarshalStrict(in, &c)
 	if err != nil {
-		metrics.LastConfigReloadSuccessful.Set(0)
-		return c, fmt.Errorf("failed to parse yaml configuration file %s: %s", filename, err)
+		return fmt.Errorf("failed to parse yaml configuration file %s: %s", filename, err)
 	}
 
-	metrics.LastConfigReloadSuccessful.Set(1)
-	metrics.LastConfigReloadTime.SetToCurrentTime()
-	return c, nil
+	l.sources[filename] = in
+	if err := l.merge(filename, c); err != nil {
+		return err
+	}
+
+	for _, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include %s in configuration file %s: %s", pattern, filename, err)
+		}
+		for _, f := range files {
+			if err := l.loadFile(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *loader) merge(filename string, c internal.Configuration) error {
+	if c.DefaultTemplate != nil {
+		if l.defaultTemplateFile != "" {
+			return fmt.Errorf("default template is defined in both %s and %s", l.defaultTemplateFile, filename)
+		}
+		l.defaultTemplateFile = filename
+		l.cnf.DefaultTemplate = c.DefaultTemplate
+	}
+
+	if c.Route != nil {
+		if l.routeFile != "" {
+			return fmt.Errorf("route is defined in both %s and %s", l.routeFile, filename)
+		}
+		l.routeFile = filename
+		l.cnf.Route = c.Route
+	}
+
+	for i := range c.Matchers {
+		c.Matchers[i].File = filename
+	}
+	l.cnf.Matchers = append(l.cnf.Matchers, c.Matchers...)
+	l.cnf.TimeIntervals = append(l.cnf.TimeIntervals, c.TimeIntervals...)
+	return nil
+}
+
+// problemsError joins all the problems found in the configuration file
+func problemsError(filename string, problems []configcheck.Problem) error {
+	lines := make([]string, 0, len(problems))
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	return fmt.Errorf("invalid configuration %s: %s", filename, strings.Join(lines, "; "))
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/configcheck"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/server"
 )
 
@@ -37,6 +38,7 @@ func TestLoadingConfig(t *testing.T) {
 					Arguments: []string{
 						"this", "alert", "is", "silly",
 					},
+					File: "fixtures/valid-config.yaml",
 				}}},
 		},
 		{
@@ -68,3 +70,96 @@ func TestLoadingConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckingConfig(t *testing.T) {
+	a := assert.New(t)
+
+	problems, err := server.Check("fixtures/server-config.yaml")
+	a.NoError(err)
+	a.Empty(problems)
+
+	problems, err = server.Check("fixtures/problems-config.yaml")
+	a.NoError(err)
+
+	messages := make([]string, 0)
+	for _, p := range problems {
+		messages = append(messages, p.String())
+	}
+	a.Equal([]string{
+		`fixtures/problems-config.yaml:3: default template: invalid match template: template: match:1: unexpected "}" in operand`,
+		"fixtures/problems-config.yaml:7: warning: matcher restart is shadowed by matcher all in fixtures/problems-config.yaml:5, which matches all the alerts it does",
+		`fixtures/problems-config.yaml:8: warning: matcher restart: command restart-the-world.sh can't be executed: exec: "restart-the-world.sh": executable file not found in $PATH`,
+		"fixtures/problems-config.yaml:12: matcher restart: invalid success template: template: success:1: missing value for if",
+		"fixtures/problems-config.yaml:13: matcher all is defined more than once, first in fixtures/problems-config.yaml:5",
+	}, messages)
+
+	_, err = server.Check("fixtures/invalid-config.yaml")
+	a.Error(err)
+}
+
+func TestLoadingConfigFragments(t *testing.T) {
+	tt := []struct {
+		name     string
+		filename string
+		matchers []string
+		files    []string
+	}{
+		{
+			name:     "included files are loaded after the file",
+			filename: "fixtures/fragments/config.yaml",
+			matchers: []string{"platform", "backend", "frontend"},
+			files: []string{
+				"fixtures/fragments/config.yaml",
+				"fixtures/fragments/teams/backend.yaml",
+				"fixtures/fragments/teams/frontend.yaml",
+			},
+		},
+		{
+			name:     "files in a directory are loaded in name order",
+			filename: "fixtures/fragments/teams",
+			matchers: []string{"backend", "frontend"},
+			files: []string{
+				"fixtures/fragments/teams/backend.yaml",
+				"fixtures/fragments/teams/frontend.yaml",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a := assert.New(t)
+
+			c, err := server.Load(tc.filename)
+			a.NoError(err)
+
+			matchers := make([]string, 0)
+			files := make([]string, 0)
+			for _, m := range c.Matchers {
+				matchers = append(matchers, m.Name)
+				files = append(files, m.File)
+			}
+			a.Equal(tc.matchers, matchers)
+			a.Equal(tc.files, files)
+			a.Nil(c.Include)
+		})
+	}
+}
+
+func TestLoadingInvalidConfigFragmentsFails(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := server.Load("fixtures/cycle/config.yaml")
+	a.EqualError(err, "configuration file fixtures/cycle/config.yaml is included more than once")
+
+	_, err = server.Load("fixtures")
+	a.EqualError(err, "failed to parse yaml configuration file fixtures/invalid-config.yaml: yaml: unmarshal errors:\n"+
+		"  line 3: field commands not found in type internal.MatcherConfiguration")
+
+	problems, err := server.Check("fixtures/duplicated")
+	a.NoError(err)
+	a.Equal([]configcheck.Problem{{
+		File:    "fixtures/duplicated/b.yaml",
+		Line:    5,
+		Message: "matcher restart is defined more than once, first in fixtures/duplicated/a.yaml:3",
+	}}, problems)
+}
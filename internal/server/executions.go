@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
+)
+
+const (
+	// historyOutputLimit is the maximum length of the command output that is
+	// kept in the execution history
+	historyOutputLimit = 4096
+
+	defaultExecutionsLimit = 100
+)
+
+// recordExecution persists the execution in the history, if there is one,
+// and removes the executions that are older than the retention
+func (s *Server) recordExecution(execution store.Execution, logger *log.Entry) {
+	if s.store == nil {
+		return
+	}
+
+	execution.Output = secrets.Redact(execution.Output)
+	execution.Error = secrets.Redact(execution.Error)
+	if len(execution.Output) > historyOutputLimit {
+		execution.Output = execution.Output[:historyOutputLimit] + "... (truncated)"
+	}
+
+	if _, err := s.store.AddExecution(execution); err != nil {
+		logger.Errorf("failed to record execution: %s", err)
+	}
+
+	if s.historyRetention <= 0 {
+		return
+	}
+
+	pruned, err := s.store.PruneExecutions(time.Now().Add(-s.historyRetention))
+	if err != nil {
+		logger.Errorf("failed to prune executions history: %s", err)
+	} else if pruned > 0 {
+		logger.Debugf("pruned %d executions from history", pruned)
+	}
+}
+
+func (s *Server) listExecutions(w http.ResponseWriter, r *http.Request) {
+	if s.store == nil {
+		httpError(w, "Execution history is disabled, it requires a data directory", http.StatusNotFound)
+		return
+	}
+
+	limit := defaultExecutionsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+			httpError(w, fmt.Sprintf("Invalid limit %s", l), http.StatusBadRequest)
+			return
+		}
+	}
+
+	executions, err := s.store.Executions(r.URL.Query().Get("matcher"), limit)
+	if err != nil {
+		log.Errorf("failed to list executions: %s", err)
+		httpError(w, fmt.Sprintf("Failed to list executions: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, executions)
+}
+
+func (s *Server) getExecution(w http.ResponseWriter, r *http.Request) {
+	if s.store == nil {
+		httpError(w, "Execution history is disabled, it requires a data directory", http.StatusNotFound)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	execution, err := s.store.Execution(id)
+	if err != nil {
+		log.Errorf("failed to get execution %s: %s", id, err)
+		httpError(w, fmt.Sprintf("Failed to get execution %s: %s", id, err), http.StatusInternalServerError)
+		return
+	}
+	if execution == nil {
+		httpError(w, fmt.Sprintf("Execution %s not found", id), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, execution)
+}
+
+// httpError responds with the error message, redacting the secrets that the
+// errors could contain, as the configuration ones do
+func httpError(w http.ResponseWriter, message string, status int) {
+	http.Error(w, secrets.Redact(message), status)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("failed to encode json response: %s", err)
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
+)
+
+// persistJobs stores the matches as pending jobs when the queue is persisted,
+// all of them or none
+func (s *Server) persistJobs(matches []matchPayload) ([]matchPayload, error) {
+	if s.store == nil {
+		return matches, nil
+	}
+
+	persisted := make([]matchPayload, 0, len(matches))
+	for _, m := range matches {
+		// Approved and retried jobs are already persisted
+		if m.job != nil {
+			m.job.State = store.PendingState
+			m.job.QueuedAt = time.Now()
+			if err := s.store.UpdateJob(*m.job); err != nil {
+				return nil, err
+			}
+			persisted = append(persisted, m)
+			continue
+		}
+
+		job, err := s.store.AddJob(store.Job{
+			Matcher:    m.match.Name(),
+			AlertGroup: m.alertGroup,
+			Alert:      m.match.Alert(),
+			State:      store.PendingState,
+			QueuedAt:   time.Now(),
+		})
+		if err != nil {
+			for _, p := range persisted {
+				s.store.DeleteJob(p.job.ID)
+			}
+			return nil, err
+		}
+
+		m.job = &job
+		persisted = append(persisted, m)
+	}
+	return persisted, nil
+}
+
+// startJob marks the job as running, so it's not executed again if the
+// process dies in the middle of the execution
+func (s *Server) startJob(m matchPayload, logger *log.Entry) {
+	if m.job == nil {
+		return
+	}
+
+	m.job.State = store.RunningState
+	m.job.StartedAt = time.Now()
+	if err := s.store.UpdateJob(*m.job); err != nil {
+		logger.Errorf("failed to mark job as running: %s", err)
+	}
+}
+
+// finishJob removes the job from the persisted queue
+func (s *Server) finishJob(m matchPayload, logger *log.Entry) {
+	if m.job == nil {
+		return
+	}
+
+	if err := s.store.DeleteJob(m.job.ID); err != nil {
+		logger.Errorf("failed to remove finished job: %s", err)
+	}
+}
+
+// recoverJobs queues again the jobs that were left pending in the persisted
+// queue.
+//
+// Jobs that were running when the process died are considered failed unless
+// they are configured to be executed again, as there is no way of knowing how
+// far the command got. Jobs waiting for approval keep waiting until they
+// expire.
+//
+// It must be called with the workers already running, as it will block until
+// all the jobs fit in the queue or the server shuts down
+func (s *Server) recoverJobs() {
+	if s.store == nil {
+		return
+	}
+
+	jobs, err := s.store.Jobs()
+	if err != nil {
+		log.Errorf("failed to recover persisted jobs: %s", err)
+		return
+	}
+
+	s.m.Lock()
+	m := s.matcher
+	templater := s.templater
+	s.m.Unlock()
+
+	for i := range jobs {
+		job := jobs[i]
+		logger := log.WithField("job", job.ID).
+			WithField("matcher", job.Matcher).
+			WithField("state", job.State)
+
+		match := m.Get(job.Matcher, job.AlertGroup, job.Alert)
+		if match == nil {
+			logger.Warnf("dropping persisted job as the matcher does not exist anymore")
+			metrics.JobsRecovered.WithLabelValues("dropped").Inc()
+			s.finishJob(matchPayload{job: &job}, logger)
+			continue
+		}
+
+		if job.State == store.AwaitingApprovalState {
+			payload := matchPayload{
+				alertGroup: job.AlertGroup,
+				match:      match,
+				job:        &job,
+			}
+			if job.ExpiresAt == nil || !time.Now().Before(*job.ExpiresAt) {
+				logger.Warnf("job expired while waiting for approval")
+				metrics.JobsRecovered.WithLabelValues("expired").Inc()
+				s.drop(&approval{id: job.ID, match: payload}, "approval_timeout", "")
+				continue
+			}
+
+			logger.Infof("job is waiting for approval again")
+			metrics.JobsRecovered.WithLabelValues("awaiting_approval").Inc()
+			s.holdForApproval(job.ID, payload, *job.ExpiresAt)
+			continue
+		}
+
+		if job.State == store.RunningState && !s.rerunInterrupted {
+			logger.Warnf("job was interrupted while running, considering it failed")
+			metrics.JobsRecovered.WithLabelValues("interrupted").Inc()
+			s.announce(templater.WithTemplate(match.Template()), internal.FailureEvent, TemplatePayload{
+				AlertGroup: job.AlertGroup,
+				Alert:      job.Alert,
+				Match:      match,
+				Err:        errInterrupted,
+			}, logger)
+			s.finishJob(matchPayload{job: &job}, logger)
+			continue
+		}
+
+		payload := matchPayload{
+			alertGroup:    job.AlertGroup,
+			match:         match,
+			job:           &job,
+			attempts:      job.Attempts,
+			startedAt:     job.StartedAt,
+			notifications: job.Notifications,
+		}
+
+		if job.State == store.PendingState && job.RetryAt != nil {
+			logger.Infof("job is waiting to be retried again")
+			metrics.JobsRecovered.WithLabelValues("retrying").Inc()
+			s.scheduleRetry(&pendingRetry{
+				match: payload,
+				payload: TemplatePayload{
+					AlertGroup:  job.AlertGroup,
+					Alert:       job.Alert,
+					Match:       match,
+					Err:         errInterrupted,
+					Attempt:     job.Attempts,
+					MaxAttempts: match.Retry().MaxAttempts,
+				},
+				backoff: time.Until(*job.RetryAt),
+			}, logger)
+			continue
+		}
+
+		logger.Infof("queueing persisted job again")
+		metrics.JobsRecovered.WithLabelValues("queued").Inc()
+		if !s.requeue(payload) {
+			return
+		}
+	}
+}
+
+// requeueInterval is how often requeue checks if there is room in the queue
+const requeueInterval = 100 * time.Millisecond
+
+// requeue pushes the match to the workers queue waiting for it to fit, or
+// returns false if the server is shutting down.
+//
+// The queue lock is only held while trying, so webhooks and shutdowns don't
+// wait for the queue to have room
+func (s *Server) requeue(m matchPayload) bool {
+	for {
+		s.q.Lock()
+		if s.closed {
+			s.q.Unlock()
+			return false
+		}
+		metrics.QueueDepth.Inc()
+		select {
+		case s.matches <- m:
+			s.q.Unlock()
+			return true
+		default:
+			metrics.QueueDepth.Dec()
+		}
+		s.q.Unlock()
+
+		select {
+		case <-time.After(requeueInterval):
+		case <-s.done:
+			return false
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
+)
+
+// allMatchers is the matcher name used to pause all the executions
+const allMatchers = "*"
+
+// pause is an active pause with the timer that resumes it when it expires
+type pause struct {
+	store.Pause
+	timer *time.Timer
+}
+
+type pauseRequest struct {
+	Matcher  string `json:"matcher"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+// loadPauses restores the persisted pauses, dropping the ones that expired
+// while the server was down
+func (s *Server) loadPauses() error {
+	if s.store == nil {
+		return nil
+	}
+
+	pauses, err := s.store.Pauses()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, p := range pauses {
+		if p.ExpiresAt != nil && !now.Before(*p.ExpiresAt) {
+			if err := s.store.DeletePause(p.Matcher); err != nil {
+				return err
+			}
+			continue
+		}
+		s.setPause(p)
+		log.WithField("pause", p).Infof("executions of %s are paused", p.Matcher)
+	}
+	return nil
+}
+
+// paused returns the pause that stops the executions of the matcher, if any
+func (s *Server) paused(matcher string) (store.Pause, bool) {
+	s.p.Lock()
+	defer s.p.Unlock()
+
+	for _, name := range []string{allMatchers, matcher} {
+		if p, ok := s.pauses[name]; ok {
+			return p.Pause, true
+		}
+	}
+	return store.Pause{}, false
+}
+
+// setPause activates the pause, replacing any other pause of the same matcher
+func (s *Server) setPause(p store.Pause) {
+	s.p.Lock()
+	defer s.p.Unlock()
+
+	if old, ok := s.pauses[p.Matcher]; ok && old.timer != nil {
+		old.timer.Stop()
+	}
+
+	active := &pause{Pause: p}
+	if p.ExpiresAt != nil {
+		active.timer = time.AfterFunc(time.Until(*p.ExpiresAt), func() {
+			s.expirePause(p)
+		})
+	}
+	s.pauses[p.Matcher] = active
+
+	metrics.Paused.WithLabelValues(p.Matcher).Set(1)
+}
+
+// removePause deactivates the pause of the matcher, returning false if there
+// was none
+func (s *Server) removePause(matcher string) bool {
+	s.p.Lock()
+	defer s.p.Unlock()
+
+	p, ok := s.pauses[matcher]
+	if !ok {
+		return false
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	delete(s.pauses, matcher)
+
+	metrics.Paused.DeleteLabelValues(matcher)
+	return true
+}
+
+func (s *Server) expirePause(p store.Pause) {
+	s.p.Lock()
+	current, ok := s.pauses[p.Matcher]
+	// The pause may have been replaced before the timer fired
+	if !ok || !current.PausedAt.Equal(p.PausedAt) {
+		s.p.Unlock()
+		return
+	}
+	delete(s.pauses, p.Matcher)
+	metrics.Paused.DeleteLabelValues(p.Matcher)
+	s.p.Unlock()
+
+	if s.store != nil {
+		if err := s.store.DeletePause(p.Matcher); err != nil {
+			log.Errorf("failed to delete expired pause: %s", err)
+		}
+	}
+	log.WithField("pause", p).Infof("pause of %s expired, executions are resumed", p.Matcher)
+}
+
+func (s *Server) stopPauses() {
+	s.p.Lock()
+	defer s.p.Unlock()
+
+	for _, p := range s.pauses {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+	}
+}
+
+func (s *Server) listPauses(w http.ResponseWriter, r *http.Request) {
+	s.p.Lock()
+	pauses := make([]store.Pause, 0, len(s.pauses))
+	for _, p := range s.pauses {
+		pauses = append(pauses, p.Pause)
+	}
+	s.p.Unlock()
+
+	sort.Slice(pauses, func(i, j int) bool {
+		return pauses[i].Matcher < pauses[j].Matcher
+	})
+	writeJSON(w, pauses)
+}
+
+func (s *Server) pauseMatcher(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	req, err := readPauseRequest(r)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Invalid pause request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	s.m.Lock()
+	m := s.matcher
+	s.m.Unlock()
+
+	if req.Matcher != allMatchers && m.Get(req.Matcher, internal.AlertGroup{}, nil) == nil {
+		httpError(w, fmt.Sprintf("Invalid pause request: unknown matcher %s", req.Matcher),
+			http.StatusBadRequest)
+		return
+	}
+
+	p := store.Pause{
+		Matcher:  req.Matcher,
+		Reason:   req.Reason,
+		PausedAt: time.Now(),
+	}
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			httpError(w, fmt.Sprintf("Invalid pause request: invalid duration %s", req.Duration),
+				http.StatusBadRequest)
+			return
+		}
+		expiresAt := p.PausedAt.Add(d)
+		p.ExpiresAt = &expiresAt
+	}
+
+	if s.store != nil {
+		if err := s.store.SavePause(p); err != nil {
+			log.Errorf("failed to persist pause: %s", err)
+			httpError(w, fmt.Sprintf("Failed to persist pause: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.setPause(p)
+
+	log.WithField("pause", p).Warnf("executions of %s are paused", p.Matcher)
+	writeJSON(w, p)
+}
+
+func (s *Server) resumeMatcher(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	req, err := readPauseRequest(r)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Invalid resume request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if s.store != nil {
+		if err := s.store.DeletePause(req.Matcher); err != nil {
+			log.Errorf("failed to delete pause: %s", err)
+			httpError(w, fmt.Sprintf("Failed to delete pause: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if !s.removePause(req.Matcher) {
+		httpError(w, fmt.Sprintf("Executions of %s are not paused", req.Matcher), http.StatusNotFound)
+		return
+	}
+
+	log.Warnf("executions of %s are resumed", req.Matcher)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readPauseRequest decodes the request body, where an empty matcher means all
+// of them
+func readPauseRequest(r *http.Request) (pauseRequest, error) {
+	req := pauseRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, fmt.Errorf("failed to decode body: %s", err)
+	}
+
+	req.Matcher = strings.TrimSpace(req.Matcher)
+	if req.Matcher == "" {
+		req.Matcher = allMatchers
+	}
+	return req, nil
+}
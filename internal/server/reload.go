@@ -0,0 +1,217 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
+)
+
+// TriggerReload asks for the configuration to be reloaded once the debounce
+// period is over, triggering it again in the meantime starts the period over
+func (s *Server) TriggerReload() {
+	select {
+	case s.reloads <- struct{}{}:
+	default:
+	}
+}
+
+// watchConfiguration reloads the configuration when it is triggered or when
+// the content of the configuration files changes, until the server is shut
+// down.
+//
+// The files are polled by their content so it also notices ConfigMap volumes,
+// where the files are symlinks that are swapped on updates, and files that
+// are added to the configuration directory or the included globs
+func (s *Server) watchConfiguration() {
+	var poll <-chan time.Time
+	if s.configWatchInterval > 0 {
+		ticker := time.NewTicker(s.configWatchInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+		log.Infof("watching configuration %s every %s", s.configFile, s.configWatchInterval)
+	}
+
+	s.m.Lock()
+	seen := s.configHash
+	s.m.Unlock()
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case <-s.reloads:
+			debounce = time.After(s.reloadDebounce)
+
+		case <-poll:
+			c, err := load(s.configFile)
+			if err != nil {
+				// The files may be missing or half written for a moment while
+				// they are replaced, the reload reports it if it lasts
+				log.Debugf("failed to load configuration %s: %s", s.configFile, err)
+				c.sources = map[string][]byte{"error": []byte(err.Error())}
+			}
+			if h := hash(c.sources); h != seen {
+				seen = h
+				log.Infof("configuration %s changed", s.configFile)
+				debounce = time.After(s.reloadDebounce)
+			}
+
+		case <-debounce:
+			debounce = nil
+
+			log.Infoln("reloading configuration...")
+			if err := s.LoadConfiguration(); err != nil {
+				log.Errorf("failed to reload configuration: %s", err)
+				continue
+			}
+			log.Infoln("configuration reloaded correctly")
+
+			s.m.Lock()
+			seen = s.configHash
+			s.m.Unlock()
+		}
+	}
+}
+
+// hash returns the hash of the content of all the configuration files
+func hash(sources map[string][]byte) string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(sources[name]))
+		h.Write(sources[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// configDiff are the names of the matchers that changed in a reload
+type configDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+type reloadResponse struct {
+	Hash     string    `json:"hash"`
+	LoadedAt time.Time `json:"loaded_at"`
+	configDiff
+}
+
+type configResponse struct {
+	Hash     string    `json:"hash"`
+	LoadedAt time.Time `json:"loaded_at"`
+
+	// Config is the yaml of the configuration after merging all the files
+	// and expanding the references, with the secrets redacted
+	Config string `json:"config"`
+}
+
+// diffMatchers compares the matchers by name, where moving a matcher to
+// another file doesn't change it
+func diffMatchers(previous, current []internal.MatcherConfiguration) configDiff {
+	diff := configDiff{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make([]string, 0),
+	}
+
+	byName := make(map[string]internal.MatcherConfiguration)
+	for _, m := range previous {
+		m.File = ""
+		byName[m.Name] = m
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range current {
+		seen[m.Name] = true
+		m.File = ""
+
+		old, ok := byName[m.Name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, m.Name)
+		case !reflect.DeepEqual(old, m):
+			diff.Changed = append(diff.Changed, m.Name)
+		}
+	}
+
+	for _, m := range previous {
+		if !seen[m.Name] {
+			diff.Removed = append(diff.Removed, m.Name)
+		}
+	}
+	return diff
+}
+
+func (s *Server) getConfiguration(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	config := *s.config
+	response := configResponse{
+		Hash:     s.configHash,
+		LoadedAt: s.configLoadedAt,
+	}
+	s.m.Unlock()
+
+	b, err := yaml.Marshal(redactConfiguration(config))
+	if err != nil {
+		log.Errorf("failed to encode configuration: %s", err)
+		httpError(w, fmt.Sprintf("Failed to encode configuration: %s", err), http.StatusInternalServerError)
+		return
+	}
+	response.Config = secrets.Redact(string(b))
+	writeJSON(w, response)
+}
+
+// redactConfiguration returns a copy of the configuration with the secrets
+// redacted from the fields they can be expanded in.
+//
+// They are redacted before encoding it, as yaml can write them in a different
+// way than they are, like splitting multi-line values in several lines
+func redactConfiguration(cnf internal.Configuration) internal.Configuration {
+	matchers := make([]internal.MatcherConfiguration, len(cnf.Matchers))
+	for i, m := range cnf.Matchers {
+		m.Command = secrets.Redact(m.Command)
+		m.Arguments = redactAll(m.Arguments)
+		m.ResolvedCommand = secrets.Redact(m.ResolvedCommand)
+		m.ResolvedArguments = redactAll(m.ResolvedArguments)
+		if m.Env != nil {
+			env := make(map[string]string, len(m.Env))
+			for name, value := range m.Env {
+				env[name] = secrets.Redact(value)
+			}
+			m.Env = env
+		}
+		matchers[i] = m
+	}
+	cnf.Matchers = matchers
+	return cnf
+}
+
+func redactAll(values []string) []string {
+	if values == nil {
+		return nil
+	}
+
+	redacted := make([]string, len(values))
+	for i, v := range values {
+		redacted[i] = secrets.Redact(v)
+	}
+	return redacted
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/templater"
+)
+
+// pendingRetry is a failed match waiting for its backoff to expire to be
+// queued again
+type pendingRetry struct {
+	match   matchPayload
+	payload TemplatePayload
+	backoff time.Duration
+	timer   *time.Timer
+}
+
+// scheduleRetry queues the match again once the backoff expires, so the worker
+// is free to execute other matches meanwhile
+func (s *Server) scheduleRetry(r *pendingRetry, logger *log.Entry) {
+	if job := r.match.job; job != nil {
+		retryAt := time.Now().Add(r.backoff)
+		job.State = store.PendingState
+		job.Attempts = r.match.attempts
+		job.StartedAt = r.match.startedAt
+		job.RetryAt = &retryAt
+		job.Notifications = r.match.notifications
+		if err := s.store.UpdateJob(*job); err != nil {
+			logger.Errorf("failed to persist the retry of the job: %s", err)
+		}
+	}
+
+	s.t.Lock()
+	defer s.t.Unlock()
+
+	// The retries were already stopped, the server is shutting down
+	if s.retries == nil {
+		s.giveUp(r, logger)
+		return
+	}
+
+	s.retries[r] = true
+	r.timer = time.AfterFunc(r.backoff, func() {
+		s.queueRetry(r, logger)
+	})
+}
+
+// queueRetry pushes the match back to the queue, or waits for the backoff
+// again while the queue is full.
+//
+// The retries lock is held while queueing so the server can't start shutting
+// down in the middle
+func (s *Server) queueRetry(r *pendingRetry, logger *log.Entry) {
+	s.t.Lock()
+	defer s.t.Unlock()
+
+	if !s.retries[r] {
+		return
+	}
+
+	err := s.enqueue(r.match)
+	if err == errQueueFull {
+		logger.Warnf("queue is full, retrying again in %s", r.backoff)
+		r.timer = time.AfterFunc(r.backoff, func() {
+			s.queueRetry(r, logger)
+		})
+		return
+	}
+
+	delete(s.retries, r)
+	if err != nil {
+		logger.Errorf("failed to queue the retry: %s", err)
+		r.payload.Err = fmt.Errorf("%s, failed to queue the retry: %s", r.payload.Err, err)
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.complete(r.match, r.payload, s.templaterFor(r.match), logger)
+			s.finishJob(r.match, logger)
+		}()
+	}
+}
+
+// stopRetries stops waiting for the pending retries and gives up on them, no
+// retry can be scheduled after calling it
+func (s *Server) stopRetries() {
+	s.t.Lock()
+	defer s.t.Unlock()
+
+	for r := range s.retries {
+		r.timer.Stop()
+		s.giveUp(r, log.WithField("match", r.match.match))
+	}
+	s.retries = nil
+}
+
+// giveUp fails the retry as the server is shutting down. Persisted jobs are
+// left pending instead, so they are retried when the server starts again
+func (s *Server) giveUp(r *pendingRetry, logger *log.Entry) {
+	if r.match.job != nil {
+		logger.Infof("the retry will be resumed when the server starts again")
+		return
+	}
+
+	logger.Warnf("giving up on retrying as the server is shutting down")
+	r.payload.Err = fmt.Errorf("%s, giving up on retrying as the server is shutting down", r.payload.Err)
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.complete(r.match, r.payload, s.templaterFor(r.match), logger)
+	}()
+}
+
+// templaterFor returns the templater with the template of the match
+func (s *Server) templaterFor(m matchPayload) templater.Templater {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.templater.WithTemplate(m.match.Template())
+}
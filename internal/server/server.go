@@ -1,10 +1,15 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -12,8 +17,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/configcheck"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/cooldown"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/matcher"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/templater"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/webhook"
 )
@@ -22,6 +31,12 @@ import (
 // by this app
 const SupportedWebhookVersion = "4"
 
+var (
+	errQueueFull    = errors.New("matches queue is full")
+	errShuttingDown = errors.New("server is shutting down")
+	errInterrupted  = errors.New("execution was interrupted by a restart")
+)
+
 // Args are the arguments for building a new server
 type Args struct {
 	MetricsPath    string
@@ -30,21 +45,88 @@ type Args struct {
 
 	Messenger   internal.Messenger
 	Concurrency int
+	QueueSize   int
+	RetryAfter  time.Duration
+
+	DataDir          string
+	RerunInterrupted bool
+	HistoryRetention time.Duration
+
+	ExternalURL        string
+	SlackSigningSecret string
+	APIToken           string
+
+	DryRun bool
+
+	ConfigWatchInterval time.Duration
+	ReloadDebounce      time.Duration
+}
+
+// GoString masks the secrets so the arguments can be logged
+func (a Args) GoString() string {
+	type args Args
+	masked := args(a)
+	if masked.SlackSigningSecret != "" {
+		masked.SlackSigningSecret = secrets.Mask
+	}
+	if masked.APIToken != "" {
+		masked.APIToken = secrets.Mask
+	}
+	return fmt.Sprintf("%#v", masked)
 }
 
 // Server represents a web server that processes webhooks
 type Server struct {
-	r *mux.Router
-
-	configFile string
-	address    string
-	matcher    matcher.Matcher
-	templater  templater.Templater
+	r          *mux.Router
+	httpServer *http.Server
+
+	configFile     string
+	address        string
+	matcher        matcher.Matcher
+	templater      templater.Templater
+	config         *internal.Configuration
+	configHash     string
+	configLoadedAt time.Time
+	configSecrets  []string
+
+	l                   *sync.Mutex
+	reloads             chan struct{}
+	configWatchInterval time.Duration
+	reloadDebounce      time.Duration
 
 	messenger internal.Messenger
 
-	m       *sync.Mutex
-	matches chan matchPayload
+	m *sync.Mutex
+
+	q          *sync.Mutex
+	closed     bool
+	done       chan struct{}
+	matches    chan matchPayload
+	retryAfter time.Duration
+
+	concurrency int
+	workers     *sync.WaitGroup
+
+	cooldowns *cooldown.Tracker
+
+	p      *sync.Mutex
+	pauses map[string]*pause
+
+	t       *sync.Mutex
+	retries map[*pendingRetry]bool
+
+	a           *sync.Mutex
+	approvals   map[string]*approval
+	externalURL string
+
+	slackSigningSecret string
+	apiToken           string
+
+	dryRun bool
+
+	store            *store.Store
+	rerunInterrupted bool
+	historyRetention time.Duration
 }
 
 // New returns a new web server, or fails misserably
@@ -53,19 +135,81 @@ func New(args Args) *Server {
 
 	log.Debugf("Creating new server with args: %#v", args)
 
+	concurrency := args.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// An unbuffered queue would reject every webhook, as matches are never
+	// handed to the workers directly
+	queueSize := args.QueueSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
 	s := &Server{
 		r: r,
+		httpServer: &http.Server{
+			Addr:    args.Address,
+			Handler: r,
+		},
 
 		configFile: args.ConfigFilename,
 		address:    args.Address,
 
+		l:                   &sync.Mutex{},
+		reloads:             make(chan struct{}, 1),
+		configWatchInterval: args.ConfigWatchInterval,
+		reloadDebounce:      args.ReloadDebounce,
+
 		messenger: args.Messenger,
 
 		m: &sync.Mutex{},
 
-		matches: make(chan matchPayload, args.Concurrency),
+		q:          &sync.Mutex{},
+		done:       make(chan struct{}),
+		matches:    make(chan matchPayload, queueSize),
+		retryAfter: args.RetryAfter,
+
+		concurrency: concurrency,
+		workers:     &sync.WaitGroup{},
+
+		cooldowns: cooldown.New(),
+
+		p:      &sync.Mutex{},
+		pauses: make(map[string]*pause),
+
+		t:       &sync.Mutex{},
+		retries: make(map[*pendingRetry]bool),
+
+		a:           &sync.Mutex{},
+		approvals:   make(map[string]*approval),
+		externalURL: strings.TrimRight(args.ExternalURL, "/"),
+
+		slackSigningSecret: args.SlackSigningSecret,
+		apiToken:           args.APIToken,
+
+		dryRun: args.DryRun,
+
+		rerunInterrupted: args.RerunInterrupted,
+		historyRetention: args.HistoryRetention,
 	}
 
+	if args.DataDir != "" {
+		st, err := store.Open(args.DataDir)
+		if err != nil {
+			log.Fatalf("failed to open the data directory: %s", err)
+		}
+		log.Infof("persisting the matches queue in %s", args.DataDir)
+		s.store = st
+	}
+
+	if err := s.loadPauses(); err != nil {
+		log.Fatalf("failed to load the persisted pauses: %s", err)
+	}
+
+	metrics.QueueCapacity.Set(float64(queueSize))
+	metrics.WorkersTotal.Set(float64(concurrency))
+
 	if err := s.LoadConfiguration(); err != nil {
 		log.Fatalf("failed to load initial configuration: %s", err)
 	}
@@ -74,76 +218,277 @@ func New(args Args) *Server {
 	r.HandleFunc("/webhook", s.webhookPost).Methods("POST")
 	r.HandleFunc("/-/health", s.healthyProbe).Methods("GET")
 	r.HandleFunc("/-/reload", s.triggerReloadConfiguration).Methods("POST")
+	r.HandleFunc("/api/v1/executions", s.listExecutions).Methods("GET")
+	r.HandleFunc("/api/v1/executions/{id}", s.getExecution).Methods("GET")
+	r.HandleFunc("/api/v1/pauses", s.listPauses).Methods("GET")
+	if s.apiToken != "" {
+		r.HandleFunc("/api/v1/config", s.authenticated(s.getConfiguration)).Methods("GET")
+		r.HandleFunc("/api/v1/pause", s.authenticated(s.pauseMatcher)).Methods("POST")
+		r.HandleFunc("/api/v1/resume", s.authenticated(s.resumeMatcher)).Methods("POST")
+		r.HandleFunc("/api/v1/jobs/{id}/approve", s.authenticated(s.approveJob)).Methods("POST")
+		r.HandleFunc("/api/v1/jobs/{id}/reject", s.authenticated(s.rejectJob)).Methods("POST")
+	} else {
+		r.HandleFunc("/api/v1/config", s.getConfiguration).Methods("GET")
+		log.Infof("pausing executions and approving jobs through the API is disabled as there is no API token")
+	}
+	if s.slackSigningSecret != "" {
+		r.HandleFunc("/slack/interactions", s.slackInteraction).Methods("POST")
+	}
 
 	return s
 }
 
-// Start starts a new server on the given address
+// Start starts the workers and a new server on the given address.
+//
+// It blocks until the server is shut down and all the queued matches have
+// been processed
 func (s *Server) Start() {
-	go s.processMatches()
+	s.startWorkers()
+	go s.watchConfiguration()
+
+	// Recovering can take as long as executing the jobs that don't fit in
+	// the queue, so the health checks must not wait for it
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.recoverJobs()
+	}()
+
 	log.Println("Starting listener on", s.address)
-	log.Fatal(http.ListenAndServe(s.address, s.r))
+	if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	s.workers.Wait()
 }
 
-func (s *Server) processMatches() {
-	log.Println("starting matches processor")
-	for m := range s.matches {
-		templater := s.templater.WithTemplate(m.match.Template())
-		logger := log.WithField("templater", templater).
-			WithField("payload", m.alertGroup).
-			WithField("match", m.match)
+// Shutdown stops accepting webhooks and waits for the workers to drain the
+// queue, or for the context to be done, whatever happens first
+func (s *Server) Shutdown(ctx context.Context) error {
+	log.Infoln("shutting down server...")
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown http server: %s", err)
+	}
 
-		event := internal.MatchEvent
-		message, err := templater.Expand(internal.MatchEvent, m)
+	s.stopRetries()
 
-		if err != nil {
-			logger.WithField("event", "match").
-				Warnf("failed to expand template: %s", err)
-		} else {
-			err = s.messenger.Send(event, message)
-			if err != nil {
-				logger.WithField("event", "match").
-					WithField("message", message).
-					Warnf("failed to send message: %s", err)
-			}
-		}
+	s.q.Lock()
+	s.closed = true
+	close(s.matches)
+	close(s.done)
+	s.q.Unlock()
+
+	s.stopPauses()
+	s.stopApprovals()
 
-		output, err := m.match.Execute()
-		payload := struct {
-			AlertGroup internal.AlertGroup
-			Match      matcher.Match
-			Output     string
-			Err        error
-		}{
-			m.alertGroup,
-			m.match,
-			output,
-			err,
+	drained := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Infoln("all queued matches have been processed")
+		if s.store != nil {
+			return s.store.Close()
 		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain the matches queue: %s", ctx.Err())
+	}
+}
 
-		logger = logger.WithField("payload", payload)
-		if err == nil {
-			event = internal.SuccessEvent
-			message, err = templater.Expand(internal.SuccessEvent, payload)
-			if err != nil {
-				logger.WithField("event", "success").
-					Warnf("failed to expand message: %s", err)
-			}
-		} else {
-			event = internal.FailureEvent
-			message, err = templater.Expand(internal.FailureEvent, payload)
-			if err != nil {
-				logger.WithField("event", "failure").
-					Warnf("failed to expand message: %s", err)
-			}
+func (s *Server) startWorkers() {
+	log.Printf("starting %d matches processors", s.concurrency)
+	for i := 0; i < s.concurrency; i++ {
+		s.workers.Add(1)
+		go s.processMatches(i)
+	}
+}
+
+func (s *Server) processMatches(worker int) {
+	defer s.workers.Done()
+
+	for m := range s.matches {
+		metrics.QueueDepth.Dec()
+		s.process(worker, m)
+	}
+}
+
+// process executes a single match, isolating the worker from any panic
+// produced while doing so
+func (s *Server) process(worker int, m matchPayload) {
+	metrics.WorkersBusy.Inc()
+	defer metrics.WorkersBusy.Dec()
+
+	defer func() {
+		if r := recover(); r != nil {
+			metrics.WorkerPanicsTotal.Inc()
+			log.WithField("worker", worker).
+				WithField("matcher", m.match.Name()).
+				Errorf("recovered from panic while processing match: %s", r)
 		}
+	}()
 
-		if err = s.messenger.Send(event, message); err != nil {
-			logger.WithField("message", message).
-				Errorf("failed to send message: %s", err)
+	templater := s.templaterFor(m)
+
+	logger := log.WithField("templater", templater).
+		WithField("payload", m.alertGroup).
+		WithField("match", m.match).
+		WithField("worker", worker)
+
+	s.startJob(m, logger)
+	retrying := false
+	defer func() {
+		if !retrying {
+			s.finishJob(m, logger)
 		}
+	}()
+
+	// The matcher could have been paused while the match was queued or
+	// waiting to be retried
+	if p, ok := s.paused(m.match.Name()); ok {
+		s.skip(m.alertGroup, m.match, "paused", p.Reason)
+		return
+	}
+
+	payload := TemplatePayload{
+		AlertGroup: m.alertGroup,
+		Alert:      m.match.Alert(),
+		Match:      m.match,
+	}
+
+	if m.attempts == 0 {
+		m.startedAt = time.Now()
+		m.notifications = append(m.notifications,
+			s.announce(templater, m.match.Event(), payload, logger))
+	}
+
+	retry := m.match.Retry()
+	payload.MaxAttempts = retry.MaxAttempts
+	payload.Attempt = m.attempts + 1
+
+	payload.Output, payload.Err = m.match.Execute()
+	m.attempts = payload.Attempt
+
+	if retry.ShouldRetry(payload.Err, payload.Attempt) {
+		backoff := retry.Backoff(payload.Attempt)
+		logger.WithField("attempt", payload.Attempt).
+			WithField("error", payload.Err).
+			Warnf("execution failed, retrying in %s", backoff)
+		metrics.CommandRetriesTotal.WithLabelValues(m.match.Name()).Inc()
+		m.notifications = append(m.notifications,
+			s.announce(templater, internal.RetryEvent, payload, logger.WithField("payload", payload)))
+
+		retrying = true
+		s.scheduleRetry(&pendingRetry{match: m, payload: payload, backoff: backoff}, logger)
+		return
+	}
+
+	s.complete(m, payload, templater, logger)
+}
+
+// complete announces the result of the last attempt of the match and records
+// the execution
+func (s *Server) complete(m matchPayload, payload TemplatePayload, t templater.Templater, logger *log.Entry) {
+	event := internal.SuccessEvent
+	if payload.Err != nil {
+		event = internal.FailureEvent
+	}
+	notifications := append(m.notifications,
+		s.announce(t, event, payload, logger.WithField("payload", payload)))
+
+	execution := store.Execution{
+		Matcher:       m.match.Name(),
+		AlertGroup:    m.alertGroup,
+		Alert:         m.match.Alert(),
+		StartedAt:     m.startedAt,
+		FinishedAt:    time.Now(),
+		Attempts:      payload.Attempt,
+		ExitCode:      matcher.ExitCode(payload.Err),
+		Output:        payload.Output,
+		DryRun:        m.match.DryRun(),
+		Notifications: notifications,
+	}
+	if payload.Err != nil {
+		execution.Error = payload.Err.Error()
+	}
+	s.recordExecution(execution, logger)
+}
+
+// skip records that a match is not going to be executed for the given reason,
+// and announces it without waiting for the message to be sent
+func (s *Server) skip(ag internal.AlertGroup, match matcher.Match, reason, details string) {
+	metrics.AlertsSkipped.WithLabelValues(match.Name(), reason).Inc()
+
+	s.m.Lock()
+	templater := s.templater.WithTemplate(match.Template())
+	s.m.Unlock()
+
+	logger := log.WithField("payload", ag).
+		WithField("match", match).
+		WithField("reason", reason).
+		WithField("details", details)
+	logger.Infof("skipping execution of matcher %s", match.Name())
+
+	skipped := reason
+	if details != "" {
+		skipped = fmt.Sprintf("%s: %s", reason, details)
+	}
+
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+
+		now := time.Now()
+		notification := s.announce(templater, internal.SkippedEvent, TemplatePayload{
+			AlertGroup: ag,
+			Alert:      match.Alert(),
+			Match:      match,
+			Reason:     reason,
+			Details:    details,
+		}, logger)
+
+		s.recordExecution(store.Execution{
+			Matcher:       match.Name(),
+			AlertGroup:    ag,
+			Alert:         match.Alert(),
+			StartedAt:     now,
+			FinishedAt:    now,
+			Skipped:       skipped,
+			Notifications: []store.Notification{notification},
+		}, logger)
+	}()
+}
+
+// announce expands the template for the event and sends the message,
+// returning the record of whether it was sent or not
+func (s *Server) announce(t templater.Templater, event internal.Event, payload TemplatePayload, logger *log.Entry) store.Notification {
+	logger = logger.WithField("event", event)
+
+	message, err := t.Expand(event, payload)
+	if err != nil {
+		logger.Warnf("failed to expand template: %s", err)
+		return store.Notification{Event: event, Error: err.Error()}
+	}
+	message = secrets.Redact(message)
 
+	// The buttons only work when the interactions can be received, otherwise
+	// the message is sent as any other with the links the template contains
+	am, ok := s.messenger.(internal.ApprovalMessenger)
+	if ok && event == internal.ApprovalEvent && s.slackSigningSecret != "" {
+		err = am.SendApproval(message, payload.JobID)
+	} else {
+		err = s.messenger.Send(event, message)
+	}
+	if err != nil {
+		logger.WithField("message", message).
+			Errorf("failed to send message: %s", err)
+		return store.Notification{Event: event, Error: err.Error()}
 	}
+
+	return store.Notification{Event: event, Sent: message != ""}
 }
 
 func (s *Server) webhookPost(w http.ResponseWriter, r *http.Request) {
@@ -155,7 +500,7 @@ func (s *Server) webhookPost(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		metrics.InvalidWebhooksTotal.Inc()
 		log.Printf("Failed to read payload: %s\n", err)
-		http.Error(w, fmt.Sprintf("Failed to read payload: %s", err), http.StatusBadRequest)
+		httpError(w, fmt.Sprintf("Failed to read payload: %s", err), http.StatusBadRequest)
 		return
 	}
 
@@ -166,7 +511,7 @@ func (s *Server) webhookPost(w http.ResponseWriter, r *http.Request) {
 		metrics.InvalidWebhooksTotal.Inc()
 
 		log.Printf("Invalid payload: %s\n", err)
-		http.Error(w, fmt.Sprintf("Invalid payload: %s", err), http.StatusBadRequest)
+		httpError(w, fmt.Sprintf("Invalid payload: %s", err), http.StatusBadRequest)
 		return
 	}
 
@@ -174,7 +519,7 @@ func (s *Server) webhookPost(w http.ResponseWriter, r *http.Request) {
 		metrics.InvalidWebhooksTotal.Inc()
 
 		log.Printf("Invalid payload: webhook version %s is not supported\n", alertGroup.Version)
-		http.Error(w, fmt.Sprintf("Invalid payload: webhook version %s is not supported",
+		httpError(w, fmt.Sprintf("Invalid payload: webhook version %s is not supported",
 			alertGroup.Version), http.StatusBadRequest)
 		return
 	}
@@ -182,18 +527,130 @@ func (s *Server) webhookPost(w http.ResponseWriter, r *http.Request) {
 	metrics.AlertsReceivedTotal.Inc()
 
 	s.m.Lock()
-	defer s.m.Unlock()
+	m := s.matcher
+	s.m.Unlock()
 
-	match := s.matcher.Match(*alertGroup)
-	if match == nil {
+	matches := m.Match(*alertGroup)
+	if len(matches) == 0 {
 		return
 	}
 
-	s.matches <- matchPayload{
-		*alertGroup,
-		match,
+	now := time.Now()
+	payloads := make([]matchPayload, 0, len(matches))
+	approvals := make([]matchPayload, 0)
+	overflow := make([]matcher.Match, 0)
+	cooldownKeys := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if p, ok := s.paused(match.Name()); ok {
+			s.skip(*alertGroup, match, "paused", p.Reason)
+			continue
+		}
+
+		if match.Muted(now) {
+			s.skip(*alertGroup, match, "time_interval", "")
+			continue
+		}
+
+		// The next webhook for the group will check it again
+		if match.Deferred(now) {
+			s.skip(*alertGroup, match, "min_firing", "")
+			continue
+		}
+
+		key, window := match.Cooldown()
+		if window > 0 && !s.cooldowns.Allow(key, window, now) {
+			s.skip(*alertGroup, match, "cooldown", "")
+			continue
+		}
+
+		payload := matchPayload{
+			alertGroup: *alertGroup,
+			match:      match,
+		}
+		switch {
+		case match.Approval() > 0:
+			approvals = append(approvals, payload)
+		case len(payloads) < cap(s.matches):
+			payloads = append(payloads, payload)
+		default:
+			// The group would never fit in the queue, so the matches that
+			// don't are skipped instead of rejecting every retry
+			if window > 0 {
+				s.cooldowns.Forget(key)
+			}
+			overflow = append(overflow, match)
+			continue
+		}
+		if window > 0 {
+			cooldownKeys = append(cooldownKeys, key)
+		}
+	}
+
+	if len(payloads) > 0 {
+		err = s.enqueue(payloads...)
+	}
+	if err != nil {
+		// Alertmanager retries 5xx responses, so the cooldown should not skip
+		// the retry
+		for _, key := range cooldownKeys {
+			s.cooldowns.Forget(key)
+		}
+	}
+
+	switch err {
+	case nil:
+		for _, m := range approvals {
+			s.requestApproval(m)
+		}
+		for _, match := range overflow {
+			s.skip(*alertGroup, match, "queue_full",
+				fmt.Sprintf("the group has more matches than the %d the queue holds", cap(s.matches)))
+		}
+	case errQueueFull:
+		// Alertmanager drops the notification on 4xx responses, so a 429
+		// would lose it until the next group or repeat interval
+		s.rejectWebhook(w, "queue_full", http.StatusServiceUnavailable, err)
+	case errShuttingDown:
+		s.rejectWebhook(w, "shutting_down", http.StatusServiceUnavailable, err)
+	default:
+		s.rejectWebhook(w, "store_error", http.StatusServiceUnavailable, err)
+	}
+}
+
+// enqueue pushes all the matches to the workers queue without blocking,
+// failing if there is no room for all of them or the server is shutting down
+func (s *Server) enqueue(matches ...matchPayload) error {
+	s.q.Lock()
+	defer s.q.Unlock()
+
+	if s.closed {
+		return errShuttingDown
+	}
+
+	if len(s.matches)+len(matches) > cap(s.matches) {
+		return errQueueFull
 	}
 
+	matches, err := s.persistJobs(matches)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range matches {
+		metrics.QueueDepth.Inc()
+		s.matches <- m
+	}
+	return nil
+}
+
+func (s *Server) rejectWebhook(w http.ResponseWriter, reason string, status int, err error) {
+	metrics.WebhooksRejectedTotal.WithLabelValues(reason).Inc()
+	log.Warnf("Rejecting webhook: %s", err)
+
+	if s.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.retryAfter.Seconds())))
+	}
+	httpError(w, fmt.Sprintf("Rejecting webhook: %s", err), status)
 }
 
 func (s *Server) healthyProbe(w http.ResponseWriter, r *http.Request) {
@@ -201,37 +658,137 @@ func (s *Server) healthyProbe(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) triggerReloadConfiguration(w http.ResponseWriter, r *http.Request) {
 	log.Infoln("reloading configuration...")
-	if err := s.LoadConfiguration(); err != nil {
-		http.Error(w, fmt.Sprintf("failed to reload configuration: %s", err),
+	diff, err := s.reloadConfiguration()
+	if err != nil {
+		httpError(w, fmt.Sprintf("failed to reload configuration: %s", err),
 			http.StatusInternalServerError)
-	} else {
-		log.Infoln("configuration reloaded correctly")
+		return
+	}
+	log.Infoln("configuration reloaded correctly")
+
+	s.m.Lock()
+	response := reloadResponse{
+		Hash:       s.configHash,
+		LoadedAt:   s.configLoadedAt,
+		configDiff: diff,
 	}
+	s.m.Unlock()
+	writeJSON(w, response)
 }
 
-// LoadConfiguration reloads the configuration file
+// LoadConfiguration reloads the configuration file, recording the outcome in
+// the reload metrics
 func (s *Server) LoadConfiguration() error {
-	c, err := Load(s.configFile)
+	_, err := s.reloadConfiguration()
+	return err
+}
+
+// reloadConfiguration reloads the configuration file, returning which matchers
+// changed
+func (s *Server) reloadConfiguration() (configDiff, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	diff, err := s.loadConfiguration()
 	if err != nil {
-		return err
+		metrics.LastConfigReloadSuccessful.Set(0)
+		return diff, err
 	}
-	m, err := matcher.New(c)
+
+	metrics.LastConfigReloadSuccessful.Set(1)
+	metrics.LastConfigReloadTime.SetToCurrentTime()
+	return diff, nil
+}
+
+func (s *Server) loadConfiguration() (configDiff, error) {
+	c, err := load(s.configFile)
 	if err != nil {
-		return err
+		return configDiff{}, err
+	}
+	if s.dryRun {
+		for i := range c.Matchers {
+			c.Matchers[i].DryRun = true
+		}
+	}
+
+	// Registered before checking so the problems don't show them either,
+	// along with the ones in use until the new configuration is
+	s.m.Lock()
+	active := s.configSecrets
+	s.m.Unlock()
+	secrets.Set(configurationSecrets, append(append([]string{}, active...), c.secrets...)...)
+
+	problems := configcheck.Check(c.Configuration, c.sources)
+	if errs := configcheck.Errors(problems); len(errs) > 0 {
+		return configDiff{}, problemsError(s.configFile, errs)
+	}
+	for _, p := range problems {
+		log.Warnf("Configuration problem: %s", p)
+	}
+
+	m, err := matcher.New(c.Configuration)
+	if err != nil {
+		return configDiff{}, err
 	}
 
 	s.m.Lock()
 	defer s.m.Unlock()
 
+	var diff configDiff
+	if s.config != nil {
+		diff = diffMatchers(s.config.Matchers, c.Matchers)
+		log.WithFields(log.Fields{
+			"added":   diff.Added,
+			"removed": diff.Removed,
+			"changed": diff.Changed,
+		}).Infof("configuration matchers changed: %d added, %d removed and %d changed",
+			len(diff.Added), len(diff.Removed), len(diff.Changed))
+	}
+
 	s.matcher = m
 	s.templater = templater.Templater{
 		DefaultTemplate: c.DefaultTemplate,
 	}
+	s.config = &c.Configuration
+	s.configHash = hash(c.sources)
+	s.configLoadedAt = time.Now()
+	s.configSecrets = c.secrets
+	secrets.Set(configurationSecrets, c.secrets...)
 
-	return nil
+	metrics.ConfigHash.Reset()
+	metrics.ConfigHash.WithLabelValues(s.configHash).Set(1)
+
+	return diff, nil
 }
 
 type matchPayload struct {
 	alertGroup internal.AlertGroup
 	match      matcher.Match
+
+	// job is only set when the queue is persisted
+	job *store.Job
+
+	// attempts is the number of times the match was already executed, and
+	// startedAt and notifications what those attempts recorded
+	attempts      int
+	startedAt     time.Time
+	notifications []store.Notification
+}
+
+// TemplatePayload is the data that is available to the message templates
+type TemplatePayload struct {
+	AlertGroup internal.AlertGroup
+	Alert      *internal.Alert
+	Match      matcher.Match
+	Output     string
+	Err        error
+	Reason     string
+	Details    string
+
+	JobID      string
+	ApproveURL string
+	RejectURL  string
+
+	Attempt     int
+	MaxAttempts int
 }
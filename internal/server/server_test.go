@@ -0,0 +1,1101 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
+)
+
+type recordingMessenger struct {
+	m        sync.Mutex
+	messages []string
+}
+
+func (r *recordingMessenger) Send(event internal.Event, message string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *recordingMessenger) Messages() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]string{}, r.messages...)
+}
+
+func newTestServer(concurrency, queueSize int) (*Server, *recordingMessenger) {
+	return newTestServerWithArgs(Args{
+		Concurrency: concurrency,
+		QueueSize:   queueSize,
+	})
+}
+
+func newTestServerWithArgs(args Args) (*Server, *recordingMessenger) {
+	m := &recordingMessenger{}
+	if args.ConfigFilename == "" {
+		args.ConfigFilename = "fixtures/server-config.yaml"
+	}
+	args.MetricsPath = "/metrics"
+	args.RetryAfter = 10 * time.Second
+	args.Messenger = m
+	if args.APIToken == "" {
+		args.APIToken = testAPIToken
+	}
+	return New(args), m
+}
+
+func postAlert(s *Server, alertname string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"version": "4", "status": "firing", "commonLabels": {"alertname": %q}}`, alertname)
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("POST", "/webhook", bytes.NewBufferString(body)))
+	return w
+}
+
+func TestWorkersExecuteMatchesConcurrently(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(4, 10)
+	s.startWorkers()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		a.Equal(http.StatusOK, postAlert(s, "SlowAlert").Code)
+	}
+
+	a.NoError(s.Shutdown(context.Background()))
+	a.True(time.Since(start) < 1500*time.Millisecond,
+		"slow commands should have been executed concurrently")
+
+	a.Len(m.Messages(), 8)
+	a.Contains(m.Messages(), "success slow")
+}
+
+func TestShutdownDrainsTheQueue(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(1, 10)
+
+	for i := 0; i < 5; i++ {
+		a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	}
+	s.startWorkers()
+
+	a.NoError(s.Shutdown(context.Background()))
+
+	successes := 0
+	for _, msg := range m.Messages() {
+		if msg == "success echo" {
+			successes++
+		}
+	}
+	a.Equal(5, successes)
+}
+
+func TestShutdownGivesUpWhenContextIsDone(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newTestServer(1, 10)
+
+	a.Equal(http.StatusOK, postAlert(s, "SlowAlert").Code)
+	s.startWorkers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	a.EqualError(s.Shutdown(ctx), "failed to drain the matches queue: context deadline exceeded")
+}
+
+func TestWebhookIsRejectedWhenTheQueueIsFull(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newTestServer(1, 1)
+
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+
+	w := postAlert(s, "EchoAlert")
+	a.Equal(http.StatusServiceUnavailable, w.Code)
+	a.Equal("10", w.Header().Get("Retry-After"))
+
+	done := make(chan error)
+	go func() { done <- s.LoadConfiguration() }()
+	select {
+	case err := <-done:
+		a.NoError(err)
+	case <-time.After(time.Second):
+		a.Fail("reloading the configuration should not wait on a full queue")
+	}
+}
+
+func TestZeroQueueSizeStillQueuesMatches(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newTestServer(1, 0)
+
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	a.Equal(http.StatusServiceUnavailable, postAlert(s, "EchoAlert").Code)
+}
+
+func TestWebhookIsRejectedWhenShuttingDown(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newTestServer(1, 1)
+	s.startWorkers()
+
+	a.NoError(s.Shutdown(context.Background()))
+
+	w := postAlert(s, "EchoAlert")
+	a.Equal(http.StatusServiceUnavailable, w.Code)
+	a.Equal("10", w.Header().Get("Retry-After"))
+}
+
+func postAlerts(s *Server, alertname string, hostnames ...string) *httptest.ResponseRecorder {
+	alerts := make([]string, 0)
+	for _, hostname := range hostnames {
+		alerts = append(alerts, fmt.Sprintf(`{"status": "firing", "labels": {"alertname": %q, "hostname": %q}}`,
+			alertname, hostname))
+	}
+	body := fmt.Sprintf(`{"version": "4", "status": "firing", "commonLabels": {"alertname": %q}, "alerts": [%s]}`,
+		alertname, strings.Join(alerts, ","))
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("POST", "/webhook", bytes.NewBufferString(body)))
+	return w
+}
+
+func TestPerAlertMatchesAreExecutedAsDifferentJobs(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(2, 10)
+	s.startWorkers()
+
+	a.Equal(http.StatusOK, postAlerts(s, "FanOutAlert", "host-1", "host-2", "host-3").Code)
+	a.NoError(s.Shutdown(context.Background()))
+
+	messages := m.Messages()
+	a.Contains(messages, "match fanout host-1")
+	a.Contains(messages, "match fanout host-2")
+	a.Contains(messages, "match fanout host-3")
+}
+
+func TestPerAlertMatchesThatNeverFitInTheQueueAreSkipped(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(1, 2)
+
+	a.Equal(http.StatusOK, postAlerts(s, "FanOutAlert", "host-1", "host-2", "host-3").Code)
+	s.workers.Wait()
+	a.Len(s.matches, 2)
+	a.Len(m.Messages(), 1, "the match that doesn't fit is announced as skipped")
+	a.Equal(1.0, testutil.ToFloat64(metrics.AlertsSkipped.WithLabelValues("fanout", "queue_full")))
+
+	// The matches that fit are rejected while the queue has no room for them
+	a.Equal(http.StatusServiceUnavailable, postAlerts(s, "FanOutAlert", "host-1", "host-2", "host-3").Code)
+	a.Len(s.matches, 2)
+}
+
+func TestPersistedJobsAreRecoveredAfterARestart(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+
+	// Simulate the process dying while executing the first job
+	running := <-s.matches
+	s.startJob(running, log.WithField("test", true))
+	a.NoError(s.store.Close())
+
+	s, m := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	s.startWorkers()
+	s.recoverJobs()
+	a.NoError(s.Shutdown(context.Background()))
+
+	a.Equal([]string{"failure echo", "match echo", "success echo"}, m.Messages())
+
+	s, m = newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	s.startWorkers()
+	s.recoverJobs()
+	a.NoError(s.Shutdown(context.Background()))
+
+	a.Empty(m.Messages(), "finished jobs are not recovered again")
+}
+
+func TestRecoveringJobsDoesNotBlockTheServer(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	for i := 0; i < 3; i++ {
+		a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	}
+	a.NoError(s.store.Close())
+
+	// Without workers the recovered jobs never fit in the queue
+	s, _ = newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 1, DataDir: dir})
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.recoverJobs()
+	}()
+	for i := 0; i < 100 && len(s.matches) < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.Equal(http.StatusServiceUnavailable, postAlert(s, "EchoAlert").Code)
+	a.NoError(s.Shutdown(context.Background()))
+
+	s, _ = newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	defer s.store.Close()
+	jobs, err := s.store.Jobs()
+	a.NoError(err)
+	a.Len(jobs, 3, "the jobs that were not executed are kept")
+}
+
+func TestInterruptedJobsCanBeExecutedAgain(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+
+	running := <-s.matches
+	s.startJob(running, log.WithField("test", true))
+	a.NoError(s.store.Close())
+
+	s, m := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir, RerunInterrupted: true})
+	s.startWorkers()
+	s.recoverJobs()
+	a.NoError(s.Shutdown(context.Background()))
+
+	a.Equal([]string{"match echo", "success echo"}, m.Messages())
+}
+
+func TestExecutionsHistory(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	defer s.store.Close()
+
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	a.Equal(http.StatusOK, postAlert(s, "FailingAlert").Code)
+	s.process(0, <-s.matches)
+	s.process(0, <-s.matches)
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/executions", nil))
+	a.Equal(http.StatusOK, w.Code)
+
+	executions := make([]store.Execution, 0)
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &executions))
+	a.Len(executions, 2)
+
+	failed := executions[0]
+	a.Equal("fail", failed.Matcher)
+	a.Equal(3, failed.ExitCode)
+	a.Equal("exit status 3", failed.Error)
+	a.Equal("failing\n", failed.Output)
+	a.Equal("FailingAlert", failed.AlertGroup.CommonLabels["alertname"])
+	a.Equal([]store.Notification{
+		{Event: internal.MatchEvent, Sent: true},
+		{Event: internal.FailureEvent, Sent: true},
+	}, failed.Notifications)
+
+	w = httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/executions?matcher=echo", nil))
+	executions = make([]store.Execution, 0)
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &executions))
+	a.Len(executions, 1)
+	a.Equal(0, executions[0].ExitCode)
+
+	w = httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/executions/"+executions[0].ID, nil))
+	a.Equal(http.StatusOK, w.Code)
+
+	execution := store.Execution{}
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &execution))
+	a.Equal(executions[0], execution)
+
+	w = httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/executions/non-existing", nil))
+	a.Equal(http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/executions?limit=none", nil))
+	a.Equal(http.StatusBadRequest, w.Code)
+}
+
+func TestExecutionsHistoryIsDisabledWithoutDataDir(t *testing.T) {
+	s, _ := newTestServer(1, 1)
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/executions", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestShutdownStopsRetrying(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(1, 1)
+	s.startWorkers()
+
+	a.Equal(http.StatusOK, postAlert(s, "RetryAlert").Code)
+	for i := 0; i < 100 && len(m.Messages()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.NoError(s.Shutdown(context.Background()))
+	a.Equal([]string{
+		"match retry",
+		"retry retry 1/3",
+		"failure retry after 1: exit status 1, giving up on retrying as the server is shutting down",
+	}, m.Messages())
+}
+
+func TestRetriesDoNotBlockTheWorkers(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(1, 10)
+	s.startWorkers()
+
+	a.Equal(http.StatusOK, postAlert(s, "RetryAlert").Code)
+	for i := 0; i < 100 && len(m.Messages()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	for i := 0; i < 100 && len(m.Messages()) < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.NoError(s.Shutdown(context.Background()))
+	a.Equal([]string{
+		"match retry",
+		"retry retry 1/3",
+		"match echo",
+		"success echo",
+		"failure retry after 1: exit status 1, giving up on retrying as the server is shutting down",
+	}, m.Messages())
+}
+
+func TestPersistedRetriesAreResumedAfterARestart(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, m := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	s.startWorkers()
+	a.Equal(http.StatusOK, postAlert(s, "RetryAlert").Code)
+	for i := 0; i < 100 && len(m.Messages()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.NoError(s.Shutdown(context.Background()))
+	a.Equal([]string{"match retry", "retry retry 1/3"}, m.Messages())
+
+	s, m = newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	jobs, err := s.store.Jobs()
+	a.NoError(err)
+	if a.Len(jobs, 1) {
+		a.Equal(store.PendingState, jobs[0].State)
+		a.Equal(1, jobs[0].Attempts)
+		a.NotNil(jobs[0].RetryAt)
+
+		// Don't wait for the whole backoff
+		now := time.Now()
+		jobs[0].RetryAt = &now
+		a.NoError(s.store.UpdateJob(jobs[0]))
+	}
+
+	s.startWorkers()
+	s.recoverJobs()
+	for i := 0; i < 100 && len(m.Messages()) < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.NoError(s.Shutdown(context.Background()))
+	a.Equal([]string{"retry retry 2/3"}, m.Messages())
+}
+
+const testAPIToken = "api-token"
+
+func postAPI(s *Server, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+	r.Header.Set("Authorization", "Bearer "+testAPIToken)
+	s.r.ServeHTTP(w, r)
+	return w
+}
+
+func getAPI(s *Server, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", path, nil)
+	r.Header.Set("Authorization", "Bearer "+testAPIToken)
+	s.r.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPIRequiresTheToken(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newTestServer(1, 1)
+
+	for _, authorization := range []string{"", "Bearer wrong-token", testAPIToken} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/v1/pause", bytes.NewBufferString(`{"matcher": "echo"}`))
+		r.Header.Set("Authorization", authorization)
+		s.r.ServeHTTP(w, r)
+		a.Equal(http.StatusUnauthorized, w.Code, authorization)
+	}
+
+	_, paused := s.paused("echo")
+	a.False(paused)
+}
+
+func TestAPIIsDisabledWithoutToken(t *testing.T) {
+	s := New(Args{
+		ConfigFilename: "fixtures/server-config.yaml",
+		MetricsPath:    "/metrics",
+		Messenger:      &recordingMessenger{},
+	})
+	assert.Equal(t, http.StatusNotFound, postAPI(s, "/api/v1/pause", `{"matcher": "echo"}`).Code)
+}
+
+func TestPausedMatchesAreSkipped(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, m := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+
+	a.Equal(http.StatusBadRequest, postAPI(s, "/api/v1/pause", `{"matcher": "missing"}`).Code)
+	a.Equal(http.StatusBadRequest, postAPI(s, "/api/v1/pause", `{"matcher": "echo", "duration": "never"}`).Code)
+	a.Equal(http.StatusOK, postAPI(s, "/api/v1/pause",
+		`{"matcher": "echo", "reason": "incident", "duration": "1h"}`).Code)
+
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	a.Equal(http.StatusOK, postAlert(s, "FailingAlert").Code)
+	s.workers.Wait()
+	a.Len(s.matches, 1, "only the matcher that is not paused is queued")
+	a.Equal([]string{"skipped echo paused: incident"}, m.Messages())
+
+	executions, err := s.store.Executions("echo", 10)
+	a.NoError(err)
+	a.Len(executions, 1)
+	a.Equal("paused: incident", executions[0].Skipped)
+
+	// Pauses survive restarts
+	a.NoError(s.store.Close())
+	s, _ = newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 10, DataDir: dir})
+	defer s.store.Close()
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/pauses", nil))
+	a.Equal(http.StatusOK, w.Code)
+
+	pauses := make([]store.Pause, 0)
+	a.NoError(json.Unmarshal(w.Body.Bytes(), &pauses))
+	a.Len(pauses, 1)
+	a.Equal("echo", pauses[0].Matcher)
+	a.Equal("incident", pauses[0].Reason)
+	a.NotNil(pauses[0].ExpiresAt)
+
+	a.Equal(http.StatusNoContent, postAPI(s, "/api/v1/resume", `{"matcher": "echo"}`).Code)
+	a.Equal(http.StatusNotFound, postAPI(s, "/api/v1/resume", `{"matcher": "echo"}`).Code)
+
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	a.Len(s.matches, 1)
+
+	// An empty matcher pauses all of them
+	a.Equal(http.StatusOK, postAPI(s, "/api/v1/pause", `{}`).Code)
+	a.Equal(http.StatusOK, postAlert(s, "FailingAlert").Code)
+	s.workers.Wait()
+	a.Len(s.matches, 1)
+
+	_, paused := s.paused("fail")
+	a.True(paused)
+}
+
+func TestQueuedMatchesAreSkippedWhenPaused(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(1, 10)
+
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	a.Equal(http.StatusOK, postAPI(s, "/api/v1/pause", `{"matcher": "echo", "reason": "incident"}`).Code)
+
+	s.startWorkers()
+	a.NoError(s.Shutdown(context.Background()))
+	a.Equal([]string{"skipped echo paused: incident"}, m.Messages())
+}
+
+func TestPausesExpire(t *testing.T) {
+	a := assert.New(t)
+	s, _ := newTestServer(1, 1)
+
+	a.Equal(http.StatusOK, postAPI(s, "/api/v1/pause", `{"matcher": "echo", "duration": "10ms"}`).Code)
+	_, paused := s.paused("echo")
+	a.True(paused)
+
+	for i := 0; i < 100 && paused; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, paused = s.paused("echo")
+	}
+	a.False(paused)
+}
+
+// postApprovalAlert posts an alert that requires approval and returns the ID
+// of the job that waits for it
+func postApprovalAlert(t *testing.T, s *Server) string {
+	waiting := make(map[string]bool)
+	s.a.Lock()
+	for id := range s.approvals {
+		waiting[id] = true
+	}
+	s.a.Unlock()
+
+	assert.Equal(t, http.StatusOK, postAlert(s, "ApprovalAlert").Code)
+
+	s.a.Lock()
+	defer s.a.Unlock()
+	for id := range s.approvals {
+		if !waiting[id] {
+			return id
+		}
+	}
+	t.Fatal("the alert is not waiting for approval")
+	return ""
+}
+
+func TestApprovedJobsAreQueued(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 1, ExternalURL: "http://executor:9099/"})
+
+	id := postApprovalAlert(t, s)
+	s.workers.Wait()
+	a.Len(s.matches, 0, "jobs waiting for approval are not queued")
+	a.Len(id, 32)
+	a.Equal([]string{
+		fmt.Sprintf("approval approve %s http://executor:9099/api/v1/jobs/%s/approve", id, id),
+	}, m.Messages())
+
+	a.Equal(http.StatusNotFound, postAPI(s, "/api/v1/jobs/00000000000000000001/approve", "").Code)
+
+	// Approving fails while the queue is full, and the job keeps waiting
+	a.Equal(http.StatusOK, postAlert(s, "EchoAlert").Code)
+	w := postAPI(s, "/api/v1/jobs/"+id+"/approve", "")
+	a.Equal(http.StatusServiceUnavailable, w.Code)
+	a.Equal("10", w.Header().Get("Retry-After"))
+	<-s.matches
+
+	w = postAPI(s, "/api/v1/jobs/"+id+"/approve", "")
+	a.Equal(http.StatusOK, w.Code)
+	a.JSONEq(fmt.Sprintf(`{"id": %q, "matcher": "approve", "outcome": "approved"}`, id), w.Body.String())
+	a.Len(s.matches, 1)
+
+	approved := <-s.matches
+	a.Equal("approve", approved.match.Name())
+
+	a.Equal(http.StatusNotFound, postAPI(s, "/api/v1/jobs/"+id+"/approve", "").Code)
+}
+
+func TestApprovalLinksRequireTheAPIToken(t *testing.T) {
+	a := assert.New(t)
+	s := New(Args{
+		ConfigFilename: "fixtures/server-config.yaml",
+		MetricsPath:    "/metrics",
+		ExternalURL:    "http://executor:9099",
+		Messenger:      &recordingMessenger{},
+	})
+
+	id := postApprovalAlert(t, s)
+	a.Equal("", s.jobURL(id, "approve"), "the link would not work")
+	a.Equal(http.StatusNotFound, postAPI(s, "/api/v1/jobs/"+id+"/approve", "").Code)
+
+	s, _ = newTestServer(1, 1)
+	id = postApprovalAlert(t, s)
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/jobs/"+id+"/approve", nil))
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Len(s.approvals, 1)
+}
+
+func TestRejectedAndExpiredJobsAreSkipped(t *testing.T) {
+	a := assert.New(t)
+	s, m := newTestServer(1, 1)
+
+	rejected := postApprovalAlert(t, s)
+	expired := postApprovalAlert(t, s)
+
+	a.Equal(http.StatusOK, postAPI(s, "/api/v1/jobs/"+rejected+"/reject", "").Code)
+	s.expireApproval(expired)
+	s.workers.Wait()
+
+	a.Len(s.matches, 0)
+	a.Empty(s.approvals)
+	a.ElementsMatch([]string{
+		"approval approve " + rejected + " ",
+		"approval approve " + expired + " ",
+		"skipped approve rejected",
+		"skipped approve approval_timeout",
+	}, m.Messages())
+}
+
+func TestJobsWaitingForApprovalAreRecovered(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 1, DataDir: dir})
+	id := postApprovalAlert(t, s)
+	s.workers.Wait()
+	a.NoError(s.store.Close())
+
+	s, _ = newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 1, DataDir: dir})
+	defer s.store.Close()
+	s.recoverJobs()
+	a.Len(s.approvals, 1)
+
+	a.Equal(http.StatusOK, postAPI(s, "/api/v1/jobs/"+id+"/approve", "").Code)
+	jobs, err := s.store.Jobs()
+	a.NoError(err)
+	a.Len(jobs, 1)
+	a.Equal(store.PendingState, jobs[0].State)
+}
+
+func postSlackInteraction(s *Server, secret, action, jobID, responseURL string) *httptest.ResponseRecorder {
+	body := url.Values{"payload": []string{fmt.Sprintf(`{
+		"type": "block_actions",
+		"user": {"username": "alice"},
+		"response_url": %q,
+		"actions": [{"action_id": %q, "value": %q}]
+	}`, responseURL, action, jobID)}}.Encode()
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+	r := httptest.NewRequest("POST", "/slack/interactions", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, r)
+	return w
+}
+
+func TestSlackInteractionsApproveJobs(t *testing.T) {
+	a := assert.New(t)
+
+	responses := make(chan string, 10)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		responses <- string(b)
+	}))
+	defer slack.Close()
+
+	s, m := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 1, SlackSigningSecret: "secret"})
+
+	approved := postApprovalAlert(t, s)
+	rejected := postApprovalAlert(t, s)
+
+	a.Equal(http.StatusUnauthorized,
+		postSlackInteraction(s, "wrong", "approve", approved, slack.URL).Code)
+	a.Len(s.approvals, 2)
+
+	a.Equal(http.StatusOK,
+		postSlackInteraction(s, "secret", "approve", approved, slack.URL).Code)
+	a.JSONEq(`{"replace_original": true, "text": "Execution of approve was approved by alice"}`, <-responses)
+	a.Len(s.matches, 1)
+
+	a.Equal(http.StatusOK,
+		postSlackInteraction(s, "secret", "reject", rejected, slack.URL).Code)
+	a.JSONEq(`{"replace_original": true, "text": "Execution of approve was rejected by alice"}`, <-responses)
+
+	a.Equal(http.StatusOK,
+		postSlackInteraction(s, "secret", "reject", rejected, slack.URL).Code)
+	a.JSONEq(fmt.Sprintf(`{"replace_original": true, "text": "Job %s is not waiting for approval anymore"}`, rejected),
+		<-responses)
+
+	s.workers.Wait()
+	a.Contains(m.Messages(), "skipped approve rejected: by alice")
+}
+
+// approvalMessenger records which messages were sent with the approval
+// buttons
+type approvalMessenger struct {
+	recordingMessenger
+	approvals []string
+}
+
+func (r *approvalMessenger) SendApproval(message, jobID string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.approvals = append(r.approvals, jobID)
+	return nil
+}
+
+func TestApprovalButtonsAreOnlySentWithSlackInteractions(t *testing.T) {
+	a := assert.New(t)
+
+	for _, secret := range []string{"", "secret"} {
+		m := &approvalMessenger{}
+		s := New(Args{
+			ConfigFilename:     "fixtures/server-config.yaml",
+			MetricsPath:        "/metrics",
+			Messenger:          m,
+			SlackSigningSecret: secret,
+		})
+
+		id := postApprovalAlert(t, s)
+		s.workers.Wait()
+
+		if secret == "" {
+			a.Empty(m.approvals)
+			a.Equal([]string{"approval approve " + id + " "}, m.Messages())
+		} else {
+			a.Equal([]string{id}, m.approvals)
+			a.Empty(m.Messages())
+		}
+	}
+}
+
+func TestSlackInteractionsAreDisabledWithoutSigningSecret(t *testing.T) {
+	s, _ := newTestServer(1, 1)
+	w := postSlackInteraction(s, "", "approve", "00000000000000000001", "http://localhost")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDryRunSimulatesAllExecutions(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, m := newTestServerWithArgs(Args{Concurrency: 1, QueueSize: 1, DataDir: dir, DryRun: true})
+	defer s.store.Close()
+
+	a.Equal(http.StatusOK, postAlert(s, "FailingAlert").Code)
+	s.process(0, <-s.matches)
+	a.Equal([]string{"match fail", "success fail"}, m.Messages())
+
+	executions, err := s.store.Executions("fail", 1)
+	a.NoError(err)
+	a.Len(executions, 1)
+	a.True(executions[0].DryRun)
+	a.Equal("dry run: sh -c echo failing; exit 3", executions[0].Output)
+}
+
+// writeConfigMap writes the configuration like kubernetes does in ConfigMap
+// volumes, where the file is a symlink to a versioned directory that is
+// swapped on updates
+func writeConfigMap(dir, version, config string) error {
+	if err := os.Mkdir(filepath.Join(dir, version), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, version, "config.yaml"), []byte(config), 0644); err != nil {
+		return err
+	}
+	if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))
+}
+
+func (s *Server) hasMatcher(name string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.matcher.Get(name, internal.AlertGroup{}, nil) != nil
+}
+
+func TestConfigurationIsReloadedWhenTheFileChanges(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config, err := ioutil.ReadFile("fixtures/server-config.yaml")
+	a.NoError(err)
+	a.NoError(writeConfigMap(dir, "..v1", string(config)))
+	a.NoError(os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml")))
+
+	s, _ := newTestServerWithArgs(Args{
+		ConfigFilename:      filepath.Join(dir, "config.yaml"),
+		Concurrency:         1,
+		QueueSize:           1,
+		ConfigWatchInterval: 10 * time.Millisecond,
+		ReloadDebounce:      10 * time.Millisecond,
+	})
+	go s.watchConfiguration()
+	a.False(s.hasMatcher("reloaded"))
+
+	a.NoError(writeConfigMap(dir, "..v2", string(config)+`
+  - name: reloaded
+    command: echo
+    labels:
+      alertname: ^ReloadedAlert$
+`))
+
+	reloaded := false
+	for i := 0; i < 100 && !reloaded; i++ {
+		time.Sleep(10 * time.Millisecond)
+		reloaded = s.hasMatcher("reloaded")
+	}
+	a.True(reloaded)
+	a.Equal(1.0, testutil.ToFloat64(metrics.LastConfigReloadSuccessful))
+
+	a.NoError(s.Shutdown(context.Background()))
+}
+
+func TestTriggeredReloadsAreDebounced(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.yaml")
+	config, err := ioutil.ReadFile("fixtures/server-config.yaml")
+	a.NoError(err)
+	a.NoError(ioutil.WriteFile(filename, config, 0644))
+
+	s, _ := newTestServerWithArgs(Args{
+		ConfigFilename: filename,
+		Concurrency:    1,
+		QueueSize:      1,
+		ReloadDebounce: 100 * time.Millisecond,
+	})
+	go s.watchConfiguration()
+
+	a.NoError(ioutil.WriteFile(filename, []byte("matchers:\n  - commands: echo\n"), 0644))
+	s.TriggerReload()
+	time.Sleep(60 * time.Millisecond)
+	s.TriggerReload()
+	time.Sleep(60 * time.Millisecond)
+
+	// The second trigger started the debounce period over
+	a.Equal(1.0, testutil.ToFloat64(metrics.LastConfigReloadSuccessful))
+
+	time.Sleep(200 * time.Millisecond)
+	a.Equal(0.0, testutil.ToFloat64(metrics.LastConfigReloadSuccessful))
+	a.True(s.hasMatcher("echo"), "the previous configuration should be kept")
+
+	a.NoError(s.Shutdown(context.Background()))
+}
+
+func TestSecretsAreNotAnnounced(t *testing.T) {
+	a := assert.New(t)
+
+	os.Setenv("CAE_TEST_TOKEN", "s3cr3t-token")
+	os.Setenv("CAE_TEST_URL", "https://deploy.example.com")
+	defer os.Unsetenv("CAE_TEST_TOKEN")
+	defer os.Unsetenv("CAE_TEST_URL")
+
+	s, m := newTestServerWithArgs(Args{
+		ConfigFilename:     "fixtures/secrets-config.yaml",
+		Concurrency:        1,
+		QueueSize:          1,
+		SlackSigningSecret: "slack-signing-secret",
+	})
+	a.NotContains(fmt.Sprintf("%#v", Args{SlackSigningSecret: "slack-signing-secret"}), "slack-signing-secret")
+
+	a.Equal(http.StatusOK, postAlert(s, "DeployAlert").Code)
+	s.startWorkers()
+	a.NoError(s.Shutdown(context.Background()))
+
+	a.Equal([]string{
+		"deploying to https://deploy.example.com",
+		"deployed: <redacted> <redacted>\n",
+	}, m.Messages())
+}
+
+func TestConfigurationIsRedacted(t *testing.T) {
+	a := assert.New(t)
+
+	os.Setenv("CAE_TEST_TOKEN", "s3cr3t-token")
+	os.Setenv("CAE_TEST_URL", "https://deploy.example.com")
+	defer os.Unsetenv("CAE_TEST_TOKEN")
+	defer os.Unsetenv("CAE_TEST_URL")
+
+	s, _ := newTestServerWithArgs(Args{ConfigFilename: "fixtures/secrets-config.yaml"})
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/config", nil))
+	a.Equal(http.StatusUnauthorized, w.Code)
+
+	w = getAPI(s, "/api/v1/config")
+	a.Equal(http.StatusOK, w.Code)
+
+	response := configResponse{}
+	a.NoError(json.NewDecoder(w.Body).Decode(&response))
+	a.Len(response.Hash, 64)
+	a.False(response.LoadedAt.IsZero())
+	a.Contains(response.Config, "name: deploy")
+	a.Contains(response.Config, "DEPLOY_PASSWORD: <redacted>")
+	a.Contains(response.Config, "on_match: deploying to https://deploy.example.com")
+	a.NotContains(response.Config, "s3cr3t")
+
+	a.Equal(1.0, testutil.ToFloat64(metrics.ConfigHash.WithLabelValues(response.Hash)))
+}
+
+func TestMultiLineSecretsAreRedactedFromTheConfiguration(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	key := filepath.Join(dir, "key")
+	a.NoError(ioutil.WriteFile(key, []byte("-----BEGIN KEY-----\ns3cr3t-key\n-----END KEY-----\n"), 0600))
+	filename := filepath.Join(dir, "config.yaml")
+	a.NoError(ioutil.WriteFile(filename, []byte(fmt.Sprintf(`---
+matchers:
+  - name: deploy
+    command: deploy.sh
+    args: ['--key', '${file:%s}']
+    env:
+      KEY: '${file:%s}'
+`, key, key)), 0644))
+
+	s, _ := newTestServerWithArgs(Args{ConfigFilename: filename})
+
+	w := getAPI(s, "/api/v1/config")
+	a.Equal(http.StatusOK, w.Code)
+
+	response := configResponse{}
+	a.NoError(json.NewDecoder(w.Body).Decode(&response))
+	a.Contains(response.Config, "- <redacted>")
+	a.Contains(response.Config, "KEY: <redacted>")
+	a.NotContains(response.Config, "s3cr3t")
+}
+
+func TestReloadReturnsWhatChanged(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.yaml")
+	config, err := ioutil.ReadFile("fixtures/server-config.yaml")
+	a.NoError(err)
+	a.NoError(ioutil.WriteFile(filename, config, 0644))
+
+	s, _ := newTestServerWithArgs(Args{ConfigFilename: filename})
+	s.m.Lock()
+	previousHash := s.configHash
+	s.m.Unlock()
+
+	changed := strings.Replace(string(config), `
+  - name: slow
+    command: sleep
+    args: ['0.5']
+    labels:
+      alertname: ^SlowAlert$`, "", 1)
+	changed = strings.Replace(changed, "args: ['echoing']", "args: ['echoing', 'again']", 1)
+	changed += `
+  - name: reloaded
+    command: echo
+    labels:
+      alertname: ^ReloadedAlert$
+`
+	a.NoError(ioutil.WriteFile(filename, []byte(changed), 0644))
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("POST", "/-/reload", nil))
+	a.Equal(http.StatusOK, w.Code)
+
+	response := reloadResponse{}
+	a.NoError(json.NewDecoder(w.Body).Decode(&response))
+	a.Equal(configDiff{
+		Added:   []string{"reloaded"},
+		Removed: []string{"slow"},
+		Changed: []string{"echo"},
+	}, response.configDiff)
+	a.NotEqual(previousHash, response.Hash)
+
+	a.Equal(0.0, testutil.ToFloat64(metrics.ConfigHash.WithLabelValues(previousHash)))
+	a.Equal(1.0, testutil.ToFloat64(metrics.ConfigHash.WithLabelValues(response.Hash)))
+}
+
+func TestConfigurationWarningsDoNotRejectIt(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.yaml")
+	a.NoError(ioutil.WriteFile(filename, []byte(`---
+matchers:
+  - name: all
+    command: echo
+  - name: shadowed
+    command: not-a-real-command
+`), 0644))
+
+	s, _ := newTestServerWithArgs(Args{ConfigFilename: filename})
+	a.True(s.hasMatcher("all"))
+
+	a.NoError(ioutil.WriteFile(filename, []byte(`---
+matchers:
+  - name: all
+    command: echo
+  - name: all
+    command: echo
+`), 0644))
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("POST", "/-/reload", nil))
+	a.Equal(http.StatusInternalServerError, w.Code)
+	a.Contains(w.Body.String(), "matcher all is defined more than once")
+}
+
+func TestReloadErrorsAreRedacted(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "server")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	os.Setenv("CAE_TEST_TOKEN", "s3cr3t-token")
+	defer os.Unsetenv("CAE_TEST_TOKEN")
+
+	filename := filepath.Join(dir, "config.yaml")
+	config, err := ioutil.ReadFile("fixtures/server-config.yaml")
+	a.NoError(err)
+	a.NoError(ioutil.WriteFile(filename, config, 0644))
+
+	s, _ := newTestServerWithArgs(Args{ConfigFilename: filename})
+
+	a.NoError(ioutil.WriteFile(filename, []byte(`---
+matchers:
+  - name: leak
+    command: echo
+    args: ['--token=${CAE_TEST_TOKEN}%{missing}']
+`), 0644))
+
+	w := httptest.NewRecorder()
+	s.r.ServeHTTP(w, httptest.NewRequest("POST", "/-/reload", nil))
+	a.Equal(http.StatusInternalServerError, w.Code)
+	a.Contains(w.Body.String(), `"--token=<redacted>%{missing}"`)
+	a.NotContains(w.Body.String(), "s3cr3t")
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/messenger"
+)
+
+// slackInteraction handles the clicks on the approval buttons, verifying
+// that they come from slack
+func (s *Server) slackInteraction(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, fmt.Sprintf("Failed to read payload: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := messenger.VerifySlackRequest(s.slackSigningSecret, r.Header, body, time.Now()); err != nil {
+		log.Warnf("Rejecting slack interaction: %s", err)
+		httpError(w, fmt.Sprintf("Rejecting slack interaction: %s", err), http.StatusUnauthorized)
+		return
+	}
+
+	interaction, err := messenger.ParseSlackInteraction(body)
+	if err != nil {
+		log.Warnf("Invalid slack interaction: %s", err)
+		httpError(w, fmt.Sprintf("Invalid slack interaction: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var name, outcome string
+	switch interaction.Action {
+	case messenger.ApproveAction:
+		name, err = s.approve(interaction.JobID, interaction.User)
+		outcome = "approved"
+	case messenger.RejectAction:
+		name, err = s.reject(interaction.JobID, interaction.User)
+		outcome = "rejected"
+	}
+
+	text := fmt.Sprintf("Execution of %s was %s by %s", name, outcome, interaction.User)
+	switch err {
+	case nil:
+	case errNotWaitingForApproval:
+		text = fmt.Sprintf("Job %s is not waiting for approval anymore", interaction.JobID)
+	default:
+		// The message keeps the buttons so it can be approved again later
+		text = fmt.Sprintf("Failed to queue execution of %s: %s", name, err)
+		if err := messenger.RespondSlackInteraction(interaction.ResponseURL, text, false); err != nil {
+			log.Errorf("failed to respond to slack interaction: %s", err)
+		}
+		return
+	}
+
+	if err := messenger.RespondSlackInteraction(interaction.ResponseURL, text, true); err != nil {
+		log.Errorf("failed to respond to slack interaction: %s", err)
+	}
+}
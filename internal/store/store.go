@@ -0,0 +1,350 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+// Filename is the name of the database file created inside the data directory
+const Filename = "chief-alert-executor.db"
+
+var (
+	jobsBucket       = []byte("jobs")
+	executionsBucket = []byte("executions")
+	pausesBucket     = []byte("pauses")
+)
+
+// Job states
+const (
+	PendingState          = "pending"
+	RunningState          = "running"
+	AwaitingApprovalState = "awaiting_approval"
+)
+
+// Job is a match that has been queued to be executed
+type Job struct {
+	ID         string              `json:"id"`
+	Seq        uint64              `json:"seq"`
+	Matcher    string              `json:"matcher"`
+	AlertGroup internal.AlertGroup `json:"alertGroup"`
+	Alert      *internal.Alert     `json:"alert,omitempty"`
+	State      string              `json:"state"`
+	QueuedAt   time.Time           `json:"queuedAt"`
+	StartedAt  time.Time           `json:"startedAt,omitempty"`
+	ExpiresAt  *time.Time          `json:"expiresAt,omitempty"`
+
+	// Attempts, RetryAt and Notifications are set while the job waits for
+	// its next attempt
+	Attempts      int            `json:"attempts,omitempty"`
+	RetryAt       *time.Time     `json:"retryAt,omitempty"`
+	Notifications []Notification `json:"notifications,omitempty"`
+}
+
+// Execution is the record of a command that was executed
+type Execution struct {
+	ID            string              `json:"id"`
+	Matcher       string              `json:"matcher"`
+	AlertGroup    internal.AlertGroup `json:"alertGroup"`
+	Alert         *internal.Alert     `json:"alert,omitempty"`
+	StartedAt     time.Time           `json:"startedAt"`
+	FinishedAt    time.Time           `json:"finishedAt"`
+	Attempts      int                 `json:"attempts"`
+	ExitCode      int                 `json:"exitCode"`
+	Error         string              `json:"error,omitempty"`
+	Output        string              `json:"output"`
+	Skipped       string              `json:"skipped,omitempty"`
+	DryRun        bool                `json:"dryRun,omitempty"`
+	Notifications []Notification      `json:"notifications"`
+}
+
+// Pause stops the executions of a matcher, or of all of them, until it is
+// resumed or it expires
+type Pause struct {
+	Matcher   string     `json:"matcher"`
+	Reason    string     `json:"reason,omitempty"`
+	PausedAt  time.Time  `json:"pausedAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Notification is the record of a message that was sent, or failed to be sent,
+// for an event
+type Notification struct {
+	Event internal.Event `json:"event"`
+	Sent  bool           `json:"sent"`
+	Error string         `json:"error,omitempty"`
+}
+
+// Store persists the state of the executor in a database inside a data
+// directory so it survives restarts
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database in the given directory
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %s", dir, err)
+	}
+
+	filename := filepath.Join(dir, Filename)
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %s", filename, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{jobsBucket, executionsBucket, pausesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database %s: %s", filename, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// AddJob persists a new job assigning it a random ID, and a sequence which
+// sorts jobs in the order they were added
+func (s *Store) AddJob(job Job) (Job, error) {
+	id, err := NewID()
+	if err != nil {
+		return job, fmt.Errorf("failed to add job: %s", err)
+	}
+	job.ID = id
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		job.Seq = seq
+
+		return put(b, job.ID, job)
+	})
+	if err != nil {
+		return job, fmt.Errorf("failed to add job: %s", err)
+	}
+	return job, nil
+}
+
+// NewID returns a random ID for a job, which can't be guessed as knowing it is
+// enough to approve the job
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a random id: %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// UpdateJob persists an existing job
+func (s *Store) UpdateJob(job Job) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(jobsBucket), job.ID, job)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update job %s: %s", job.ID, err)
+	}
+	return nil
+}
+
+// DeleteJob removes a job
+func (s *Store) DeleteJob(id string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete job %s: %s", id, err)
+	}
+	return nil
+}
+
+// Jobs returns all the persisted jobs in the order they were added
+func (s *Store) Jobs() ([]Job, error) {
+	jobs := make([]Job, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			job := Job{}
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("failed to decode job %s: %s", k, err)
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %s", err)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Seq < jobs[j].Seq
+	})
+	return jobs, nil
+}
+
+func put(b *bolt.Bucket, key string, value interface{}) error {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %s", key, err)
+	}
+	return b.Put([]byte(key), v)
+}
+
+// AddExecution persists a new execution assigning it an ID, which sorts
+// executions in the order they were added
+func (s *Store) AddExecution(execution Execution) (Execution, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(executionsBucket)
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		execution.ID = fmt.Sprintf("%020d", seq)
+
+		return put(b, execution.ID, execution)
+	})
+	if err != nil {
+		return execution, fmt.Errorf("failed to add execution: %s", err)
+	}
+	return execution, nil
+}
+
+// Execution returns the execution with the given ID, or nil if there is none
+func (s *Store) Execution(id string) (*Execution, error) {
+	var execution *Execution
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(executionsBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		execution = &Execution{}
+		return json.Unmarshal(v, execution)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read execution %s: %s", id, err)
+	}
+	return execution, nil
+}
+
+// Executions returns up to limit executions, the newest first, optionally
+// filtered by matcher name when it's not empty
+func (s *Store) Executions(matcher string, limit int) ([]Execution, error) {
+	executions := make([]Execution, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(executionsBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(executions) < limit; k, v = c.Prev() {
+			execution := Execution{}
+			if err := json.Unmarshal(v, &execution); err != nil {
+				return fmt.Errorf("failed to decode execution %s: %s", k, err)
+			}
+			if matcher != "" && execution.Matcher != matcher {
+				continue
+			}
+			executions = append(executions, execution)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read executions: %s", err)
+	}
+	return executions, nil
+}
+
+// PruneExecutions removes the executions that started before the given time,
+// returning how many were removed
+func (s *Store) PruneExecutions(before time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(executionsBucket)
+
+		// Deleting while iterating with a cursor skips keys, so collect first
+		keys := make([][]byte, 0)
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			execution := Execution{}
+			if err := json.Unmarshal(v, &execution); err != nil {
+				return fmt.Errorf("failed to decode execution %s: %s", k, err)
+			}
+			if !execution.StartedAt.Before(before) {
+				break
+			}
+			keys = append(keys, k)
+		}
+
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			pruned++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune executions: %s", err)
+	}
+	return pruned, nil
+}
+
+// SavePause persists a pause, replacing any other pause of the same matcher
+func (s *Store) SavePause(pause Pause) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(pausesBucket), pause.Matcher, pause)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save pause of %s: %s", pause.Matcher, err)
+	}
+	return nil
+}
+
+// DeletePause removes the pause of a matcher
+func (s *Store) DeletePause(matcher string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pausesBucket).Delete([]byte(matcher))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete pause of %s: %s", matcher, err)
+	}
+	return nil
+}
+
+// Pauses returns all the persisted pauses
+func (s *Store) Pauses() ([]Pause, error) {
+	pauses := make([]Pause, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pausesBucket).ForEach(func(k, v []byte) error {
+			pause := Pause{}
+			if err := json.Unmarshal(v, &pause); err != nil {
+				return fmt.Errorf("failed to decode pause %s: %s", k, err)
+			}
+			pauses = append(pauses, pause)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pauses: %s", err)
+	}
+	return pauses, nil
+}
@@ -0,0 +1,160 @@
+package store_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/store"
+)
+
+func openStore(t *testing.T) (*store.Store, func()) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestJobsArePersistedInOrder(t *testing.T) {
+	a := assert.New(t)
+	s, cleanup := openStore(t)
+	defer cleanup()
+
+	first, err := s.AddJob(store.Job{
+		Matcher: "first",
+		State:   store.PendingState,
+		AlertGroup: internal.AlertGroup{
+			GroupKey: "group",
+		},
+	})
+	a.NoError(err)
+	a.NotEmpty(first.ID)
+
+	second, err := s.AddJob(store.Job{
+		Matcher: "second",
+		State:   store.PendingState,
+		Alert:   &internal.Alert{Status: "firing"},
+	})
+	a.NoError(err)
+	a.Len(second.ID, 32)
+	a.NotEqual(first.ID, second.ID)
+
+	second.State = store.RunningState
+	a.NoError(s.UpdateJob(second))
+
+	jobs, err := s.Jobs()
+	a.NoError(err)
+	a.Len(jobs, 2)
+	a.Equal("first", jobs[0].Matcher)
+	a.Equal("group", jobs[0].AlertGroup.GroupKey)
+	a.Equal(store.RunningState, jobs[1].State)
+	a.Equal("firing", jobs[1].Alert.Status)
+
+	a.NoError(s.DeleteJob(first.ID))
+	jobs, err = s.Jobs()
+	a.NoError(err)
+	a.Len(jobs, 1)
+	a.Equal(second.ID, jobs[0].ID)
+}
+
+func TestJobsSurviveReopening(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "store")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, err := store.Open(dir)
+	a.NoError(err)
+	_, err = s.AddJob(store.Job{Matcher: "persisted"})
+	a.NoError(err)
+	a.NoError(s.Close())
+
+	s, err = store.Open(dir)
+	a.NoError(err)
+	defer s.Close()
+
+	jobs, err := s.Jobs()
+	a.NoError(err)
+	a.Len(jobs, 1)
+	a.Equal("persisted", jobs[0].Matcher)
+}
+
+func TestExecutionsHistory(t *testing.T) {
+	a := assert.New(t)
+	s, cleanup := openStore(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i, matcher := range []string{"old", "restart", "other", "restart"} {
+		_, err := s.AddExecution(store.Execution{
+			Matcher:   matcher,
+			StartedAt: now.Add(time.Duration(i) * time.Hour),
+			Output:    fmt.Sprintf("execution %d", i),
+		})
+		a.NoError(err)
+	}
+
+	executions, err := s.Executions("", 10)
+	a.NoError(err)
+	a.Len(executions, 4)
+	a.Equal("execution 3", executions[0].Output, "newest first")
+
+	executions, err = s.Executions("restart", 1)
+	a.NoError(err)
+	a.Len(executions, 1)
+	a.Equal("execution 3", executions[0].Output)
+
+	execution, err := s.Execution(executions[0].ID)
+	a.NoError(err)
+	a.Equal("restart", execution.Matcher)
+
+	execution, err = s.Execution("non-existing")
+	a.NoError(err)
+	a.Nil(execution)
+
+	pruned, err := s.PruneExecutions(now.Add(90 * time.Minute))
+	a.NoError(err)
+	a.Equal(2, pruned)
+
+	executions, err = s.Executions("", 10)
+	a.NoError(err)
+	a.Len(executions, 2)
+	a.Equal("execution 2", executions[1].Output)
+}
+
+func TestPauses(t *testing.T) {
+	a := assert.New(t)
+	s, cleanup := openStore(t)
+	defer cleanup()
+
+	expires := time.Now().Add(time.Hour).Round(time.Second)
+	a.NoError(s.SavePause(store.Pause{Matcher: "*", Reason: "incident"}))
+	a.NoError(s.SavePause(store.Pause{Matcher: "restart", ExpiresAt: &expires}))
+	a.NoError(s.SavePause(store.Pause{Matcher: "restart", Reason: "replaced", ExpiresAt: &expires}))
+
+	pauses, err := s.Pauses()
+	a.NoError(err)
+	a.Len(pauses, 2)
+	a.Equal("incident", pauses[0].Reason)
+	a.Equal("replaced", pauses[1].Reason)
+	a.True(expires.Equal(*pauses[1].ExpiresAt))
+
+	a.NoError(s.DeletePause("*"))
+	pauses, err = s.Pauses()
+	a.NoError(err)
+	a.Len(pauses, 1)
+	a.Equal("restart", pauses[0].Matcher)
+}
@@ -30,6 +30,18 @@ func TestTemplater(t *testing.T) {
 			"payload",
 			"matched payload",
 		},
+		{
+			"OnResolved",
+			templater.Templater{
+				DefaultTemplate: &internal.MessageTemplate{
+					OnResolved: "resolved {{ . }}",
+				},
+			},
+			nil,
+			internal.ResolvedEvent,
+			"payload",
+			"resolved payload",
+		},
 		{
 			"OnSuccess",
 			templater.Templater{
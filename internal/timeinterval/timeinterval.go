@@ -0,0 +1,200 @@
+package timeinterval
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// TimeInterval is a named list of intervals
+type TimeInterval struct {
+	Name      string
+	intervals []interval
+}
+
+type interval struct {
+	weekdays []weekdayRange
+	times    []timeRange
+	location *time.Location
+}
+
+type weekdayRange struct {
+	start, end time.Weekday
+}
+
+// timeRange holds minutes since midnight, the end is excluded
+type timeRange struct {
+	start, end int
+}
+
+// New parses the time interval configuration
+func New(cnf internal.TimeIntervalConfiguration) (*TimeInterval, error) {
+	name := strings.TrimSpace(cnf.Name)
+	if name == "" {
+		return nil, fmt.Errorf("Time interval name can't be empty")
+	}
+
+	ti := &TimeInterval{
+		Name:      name,
+		intervals: make([]interval, 0, len(cnf.TimeIntervals)),
+	}
+	for _, spec := range cnf.TimeIntervals {
+		i, err := newInterval(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time interval %s: %s", name, err)
+		}
+		ti.intervals = append(ti.intervals, i)
+	}
+	return ti, nil
+}
+
+// Contains returns true when any of the intervals contains the time
+func (ti *TimeInterval) Contains(t time.Time) bool {
+	for _, i := range ti.intervals {
+		if i.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i interval) contains(t time.Time) bool {
+	t = t.In(i.location)
+
+	if len(i.weekdays) > 0 {
+		found := false
+		for _, r := range i.weekdays {
+			if t.Weekday() >= r.start && t.Weekday() <= r.end {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(i.times) > 0 {
+		minute := t.Hour()*60 + t.Minute()
+		found := false
+		for _, r := range i.times {
+			if minute >= r.start && minute < r.end {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newInterval(spec internal.TimeIntervalSpecification) (interval, error) {
+	i := interval{
+		weekdays: make([]weekdayRange, 0, len(spec.Weekdays)),
+		times:    make([]timeRange, 0, len(spec.Times)),
+		location: time.UTC,
+	}
+
+	if spec.Location != "" {
+		loc, err := time.LoadLocation(spec.Location)
+		if err != nil {
+			return i, fmt.Errorf("invalid location %s: %s", spec.Location, err)
+		}
+		i.location = loc
+	}
+
+	for _, s := range spec.Weekdays {
+		r, err := parseWeekdays(s)
+		if err != nil {
+			return i, err
+		}
+		i.weekdays = append(i.weekdays, r)
+	}
+
+	for _, t := range spec.Times {
+		r, err := parseTimes(t)
+		if err != nil {
+			return i, err
+		}
+		i.times = append(i.times, r)
+	}
+
+	return i, nil
+}
+
+// parseWeekdays parses a day like monday or a range of days like monday:friday
+func parseWeekdays(s string) (weekdayRange, error) {
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(s)), ":", 2)
+
+	start, ok := weekdays[parts[0]]
+	if !ok {
+		return weekdayRange{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	if len(parts) == 1 {
+		return weekdayRange{start: start, end: start}, nil
+	}
+
+	end, ok := weekdays[parts[1]]
+	if !ok {
+		return weekdayRange{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	if start > end {
+		return weekdayRange{}, fmt.Errorf("invalid weekdays %q: start day can't be after the end day", s)
+	}
+	return weekdayRange{start: start, end: end}, nil
+}
+
+// parseTimes parses a range of times in the 15:04 format, where the end can
+// be 24:00 to include the end of the day
+func parseTimes(t internal.TimeRangeConfiguration) (timeRange, error) {
+	start, err := parseMinutes(t.StartTime)
+	if err != nil {
+		return timeRange{}, err
+	}
+	end, err := parseMinutes(t.EndTime)
+	if err != nil {
+		return timeRange{}, err
+	}
+	if start >= end {
+		return timeRange{}, fmt.Errorf("invalid times %s-%s: start time must be before the end time",
+			t.StartTime, t.EndTime)
+	}
+	return timeRange{start: start, end: end}, nil
+}
+
+func parseMinutes(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("invalid time %q, it must be like 15:04", s)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, it must be like 15:04", s)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, it must be like 15:04", s)
+	}
+
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %q, it must be between 00:00 and 24:00", s)
+	}
+	return hours*60 + minutes, nil
+}
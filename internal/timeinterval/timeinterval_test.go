@@ -0,0 +1,104 @@
+package timeinterval_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/timeinterval"
+)
+
+func TestContains(t *testing.T) {
+	ti, err := timeinterval.New(internal.TimeIntervalConfiguration{
+		Name: "business-hours",
+		TimeIntervals: []internal.TimeIntervalSpecification{
+			{
+				Weekdays: []string{"monday:friday"},
+				Times: []internal.TimeRangeConfiguration{
+					{StartTime: "09:00", EndTime: "12:00"},
+					{StartTime: "13:00", EndTime: "17:00"},
+				},
+				Location: "Europe/Amsterdam",
+			},
+			{
+				Weekdays: []string{"Saturday"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		contains bool
+	}{
+		{"weekday morning", time.Date(2020, 6, 1, 9, 0, 0, 0, amsterdam), true},
+		{"weekday lunch", time.Date(2020, 6, 1, 12, 0, 0, 0, amsterdam), false},
+		{"weekday afternoon", time.Date(2020, 6, 5, 16, 59, 0, 0, amsterdam), true},
+		{"weekday evening", time.Date(2020, 6, 5, 17, 0, 0, 0, amsterdam), false},
+		{"converted to the location", time.Date(2020, 6, 1, 7, 30, 0, 0, time.UTC), true},
+		{"second interval", time.Date(2020, 6, 6, 3, 0, 0, 0, amsterdam), true},
+		{"sunday", time.Date(2020, 6, 7, 10, 0, 0, 0, amsterdam), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.contains, ti.Contains(tt.time))
+		})
+	}
+}
+
+func TestInvalidTimeIntervalsFail(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     internal.TimeIntervalSpecification
+		expected string
+	}{
+		{
+			"invalid weekday",
+			internal.TimeIntervalSpecification{Weekdays: []string{"someday"}},
+			`Invalid time interval somename: invalid weekday "someday"`,
+		},
+		{
+			"reversed weekdays",
+			internal.TimeIntervalSpecification{Weekdays: []string{"friday:monday"}},
+			`Invalid time interval somename: invalid weekdays "friday:monday": start day can't be after the end day`,
+		},
+		{
+			"invalid time",
+			internal.TimeIntervalSpecification{Times: []internal.TimeRangeConfiguration{
+				{StartTime: "9:00", EndTime: "17:00"}}},
+			`Invalid time interval somename: invalid time "9:00", it must be like 15:04`,
+		},
+		{
+			"time out of range",
+			internal.TimeIntervalSpecification{Times: []internal.TimeRangeConfiguration{
+				{StartTime: "09:00", EndTime: "24:30"}}},
+			`Invalid time interval somename: invalid time "24:30", it must be between 00:00 and 24:00`,
+		},
+		{
+			"reversed times",
+			internal.TimeIntervalSpecification{Times: []internal.TimeRangeConfiguration{
+				{StartTime: "17:00", EndTime: "09:00"}}},
+			`Invalid time interval somename: invalid times 17:00-09:00: start time must be before the end time`,
+		},
+		{
+			"invalid location",
+			internal.TimeIntervalSpecification{Location: "Nowhere/Atlantis"},
+			`Invalid time interval somename: invalid location Nowhere/Atlantis: unknown time zone Nowhere/Atlantis`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := timeinterval.New(internal.TimeIntervalConfiguration{
+				Name:          "somename",
+				TimeIntervals: []internal.TimeIntervalSpecification{tt.spec},
+			})
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
@@ -1,24 +1,51 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/messenger"
 
 	"github.com/sirupsen/logrus"
 
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/configtest"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/metrics"
+	"gitlab.com/yakshaving.art/chief-alert-executor/internal/secrets"
 	"gitlab.com/yakshaving.art/chief-alert-executor/internal/server"
 )
 
 func main() {
+	logrus.SetFormatter(secrets.Formatter{Formatter: logrus.StandardLogger().Formatter})
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "test":
+			os.Exit(runTest(os.Args[2:]))
+		case "check-config":
+			os.Exit(runCheckConfig(os.Args[2:]))
+		}
+	}
 
 	address := flag.String("address", ":9099", "Address to listen to")
 	metricsPath := flag.String("metrics", "/metrics", "path in which to listen for metrics")
-	configFilename := flag.String("config", "config.yml", "configuration filename")
+	configFilename := flag.String("config", "config.yml", "configuration filename, or directory with the configuration files")
+	configWatchInterval := flag.Duration("config-watch-interval", 10*time.Second, "how often to check if the configuration file changed to reload it, disabled when zero")
+	reloadDebounce := flag.Duration("reload-debounce", 2*time.Second, "how long to wait for further changes before reloading the configuration")
 	debug := flag.Bool("debug", false, "enable debug mode")
 	concurrency := flag.Int("concurrency", 10, "how many commands can be executed concurrently")
+	queueSize := flag.Int("queue-size", 100, "how many matches can wait to be executed")
+	retryAfter := flag.Duration("retry-after", 30*time.Second, "how long alertmanager is asked to wait before retrying a rejected webhook")
+	dataDir := flag.String("data-dir", "", "directory in which to persist the matches queue, disabled when empty")
+	rerunInterrupted := flag.Bool("rerun-interrupted", false, "execute again the persisted jobs that were running when the process died")
+	historyRetention := flag.Duration("history-retention", 7*24*time.Hour, "how long to keep executions in the history, forever when zero")
+	externalURL := flag.String("external-url", "", "URL in which the executor is reachable, used to build the links to approve jobs")
+	dryRun := flag.Bool("dry-run", false, "log the commands instead of executing them")
+	shutdownTimeout := flag.Duration("shutdown-timeout", time.Minute, "how long to wait for queued matches to finish when shutting down")
 
 	flag.Parse()
 
@@ -35,13 +62,120 @@ func main() {
 		m = messenger.Slack(slackURL)
 	}
 
+	slackSigningSecret := os.Getenv("SLACK_SIGNING_SECRET")
+	secrets.Set("slack", slackURL, slackSigningSecret)
+	if slackSigningSecret != "" {
+		logrus.Info("Slack interactions enabled")
+	}
+
+	apiToken := os.Getenv("API_TOKEN")
+	secrets.Set("api", apiToken)
+
 	s := server.New(server.Args{
 		Address:        *address,
 		MetricsPath:    *metricsPath,
 		ConfigFilename: *configFilename,
 		Concurrency:    *concurrency,
+		QueueSize:      *queueSize,
+		RetryAfter:     *retryAfter,
+		DataDir:        *dataDir,
+		ExternalURL:    *externalURL,
 		Messenger:      m,
+
+		RerunInterrupted:   *rerunInterrupted,
+		HistoryRetention:   *historyRetention,
+		SlackSigningSecret: slackSigningSecret,
+		APIToken:           apiToken,
+		DryRun:             *dryRun,
+
+		ConfigWatchInterval: *configWatchInterval,
+		ReloadDebounce:      *reloadDebounce,
 	})
 
+	go func() {
+		hangups := make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		for range hangups {
+			logrus.Infoln("received SIGHUP, reloading configuration")
+			s.TriggerReload()
+		}
+	}()
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+
+		if err := s.Shutdown(ctx); err != nil {
+			logrus.Fatalf("failed to shutdown cleanly: %s", err)
+		}
+	}()
+
 	s.Start()
 }
+
+// runTest replays webhook payloads against the configuration without executing
+// anything, returning the exit code
+func runTest(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	configFilename := fs.String("config", "config.yml", "configuration filename, or directory with the configuration files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s test [-config config.yml] payload.json[=matcher,...]...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	logrus.SetLevel(logrus.WarnLevel)
+
+	cnf, err := server.Load(*configFilename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	cases := make([]configtest.Case, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		cases = append(cases, configtest.ParseCase(arg))
+	}
+
+	if !configtest.Run(os.Stdout, cnf, cases, time.Now()) {
+		return 1
+	}
+	return 0
+}
+
+// runCheckConfig reports all the problems found in the configuration,
+// returning the exit code
+func runCheckConfig(args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ExitOnError)
+	configFilename := fs.String("config", "config.yml", "configuration filename, or directory with the configuration files")
+	fs.Parse(args)
+
+	problems, err := server.Check(*configFilename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	for _, p := range problems {
+		if p.File == "" {
+			fmt.Printf("%s: %s\n", *configFilename, secrets.Redact(p.String()))
+		} else {
+			fmt.Println(secrets.Redact(p.String()))
+		}
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+
+	fmt.Printf("%s: OK\n", *configFilename)
+	return 0
+}